@@ -0,0 +1,135 @@
+// Package main measures the exploitability of strategies, which is how much a
+// player could gain by deviating from a strategy if everyone else kept to it.
+// Every seat plays the chosen strategy, and the gain of a searching best
+// response is estimated for each seat in turn. The largest gain is the
+// strategy's exploitability, which is a measure of its robustness that
+// doesn't depend on a pool of opponents.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"strings"
+
+	"github.com/bubblyworld/deep-sea-adventure/eval"
+	"github.com/bubblyworld/deep-sea-adventure/game"
+	"github.com/bubblyworld/deep-sea-adventure/learn"
+)
+
+var players = flag.Int("players", 3,
+	"number of players in each game")
+
+var strategy = flag.String("strategy", "deeper",
+	"strategy played by every seat, one of "+
+		strings.Join(game.StrategyNames, ", "))
+
+var seat = flag.Int("seat", -1,
+	"seat to measure, or every seat if negative")
+
+var games = flag.Int("games", 100,
+	"number of pairs of games to play for each seat")
+
+var depth = flag.Int("depth", 2,
+	"search depth of the best response")
+
+var rollouts = flag.Int("rollouts", 20,
+	"random games to play for each leaf of the best response's searches")
+
+var weights = flag.String("weights", "",
+	"file of feature weights or a model saved by train to evaluate leaves "+
+		"with instead of rollouts")
+
+var seed = flag.Int64("seed", 1,
+	"seed for the dice, the searches and random strategies")
+
+func main() {
+	flag.Parse()
+
+	sl := make([]game.Strategy, *players)
+	for i := range sl {
+		var err error
+		rng := rand.New(rand.NewSource(*seed + int64(i)))
+		if sl[i], err = game.Named(*strategy, rng); err != nil {
+			fail(err)
+		}
+	}
+
+	seats := []int{*seat}
+	if *seat < 0 {
+		seats = seats[:0]
+		for i := range sl {
+			seats = append(seats, i)
+		}
+	}
+
+	var leaf eval.LeafEvaluator = eval.Rollouts{Iterations: *rollouts}
+	if *weights != "" {
+		var err error
+		if leaf, err = loadLeaf(*weights); err != nil {
+			fail(fmt.Errorf("error loading weights: %v", err))
+		}
+	}
+
+	worst := math.Inf(-1)
+	for _, i := range seats {
+		ex, err := game.Exploit(sl, i, game.ExploitOptions{
+			Games: *games,
+			Depth: *depth,
+			Leaf:  leaf,
+			Seed:  *seed,
+		})
+		if err != nil {
+			fail(err)
+		}
+
+		lo, hi := ex.Gain.Interval()
+		fmt.Printf("seat %d: strategy %.3f, best response %.3f, "+
+			"gain %.3f (%.3f to %.3f)\n", i, ex.Strategy.Mean,
+			ex.BestResponse.Mean, ex.Gain.Mean, lo, hi)
+
+		if ex.Gain.Mean > worst {
+			worst = ex.Gain.Mean
+		}
+	}
+
+	fmt.Printf("exploitability of %s: %.3f\n", *strategy, worst)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+// loadLeaf returns a leaf evaluator for the given file, which is either a
+// model saved by train or a plain object of feature weights.
+func loadLeaf(path string) (eval.LeafEvaluator, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, fmt.Errorf("error parsing weights: %v", err)
+	}
+	if _, ok := fields["weights"]; !ok {
+		w, err := eval.LoadWeights(path)
+		if err != nil {
+			return nil, err
+		}
+
+		return eval.Featured{Weights: w}, nil
+	}
+
+	m, err := learn.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.Leaf(), nil
+}
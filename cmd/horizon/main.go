@@ -0,0 +1,130 @@
+// Package main is an experiment to measure the cost of limiting searches to
+// the current round. Games are played between searching players, one of
+// whom searches with a longer horizon (and optionally a bonus for treasure
+// left on the board), while the rest only search to the end of the round.
+// The seat of the long-horizon player rotates between games, and their win
+// rate is compared with the 1/players they'd get if the horizon made no
+// difference.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/bubblyworld/deep-sea-adventure/eval"
+	"github.com/bubblyworld/deep-sea-adventure/state"
+)
+
+var games = flag.Int("games", 100,
+	"number of games to play")
+
+var players = flag.Int("players", 3,
+	"number of players in each game")
+
+var depth = flag.Int("depth", 4,
+	"search depth of every player")
+
+var rollouts = flag.Int("rollouts", 20,
+	"random games to play for each leaf of the searches")
+
+var horizon = flag.Int("horizon", int(eval.HorizonGame),
+	"number of rounds searched by the long-horizon player")
+
+var bonus = flag.Float64("bonus", 0,
+	"weight of the board-value bonus for the long-horizon player")
+
+var seed = flag.Int64("seed", 1,
+	"seed for the dice and the searches")
+
+func main() {
+	flag.Parse()
+
+	rng := rand.New(rand.NewSource(*seed))
+	var wins float64
+	for i := 0; i < *games; i++ {
+		seat := i % *players
+		w, err := play(seat, rng)
+		if err != nil {
+			panic(err)
+		}
+
+		wins += w
+		fmt.Printf("game %d: seat %d won %.2f\n", i, seat, w)
+	}
+
+	n := float64(*games)
+	rate := wins / n
+	stdErr := math.Sqrt(rate * (1 - rate) / n)
+	fmt.Printf("win rate %.3f ± %.3f (baseline %.3f)\n",
+		rate, stdErr, 1/float64(*players))
+}
+
+// play plays a game with the long-horizon player in the given seat, and
+// returns their share of the win, which is split evenly on ties.
+func play(seat int, rng *rand.Rand) (float64, error) {
+	s := state.NewStandardState(*players)
+	for s.Stage() != state.StageEndOfGame {
+		d, err := decide(s, seat, rng)
+		if err != nil {
+			return 0, err
+		}
+
+		if err := s.Do(d); err != nil {
+			return 0, err
+		}
+	}
+
+	// Winners are decided by the actual values of their chips.
+	sl := eval.Score{}.Utilities(s)
+	var winners int
+	for _, score := range sl {
+		if score > sl[seat] {
+			return 0, nil
+		}
+		if score == sl[seat] {
+			winners++
+		}
+	}
+
+	return 1 / float64(winners), nil
+}
+
+// decide rolls the dice, or returns the best decision for the current player
+// according to their search.
+func decide(s state.State, seat int, rng *rand.Rand) (state.Decision, error) {
+	if s.Stage() == state.StageRoll {
+		return state.Roll(2 + rng.Intn(3) + rng.Intn(3)), nil
+	}
+
+	vdl := s.ValidDecisions()
+	if len(vdl) == 1 {
+		return vdl[0], nil
+	}
+
+	opts := eval.Options{
+		Depth: *depth,
+		Mode:  eval.ModeMaxN,
+		Leaf:  eval.Rollouts{Iterations: *rollouts},
+		Seed:  rng.Int63(),
+	}
+	if s.CurrentPlayer() == seat {
+		opts.Horizon = eval.Horizon(*horizon)
+		opts.Bonus = *bonus
+	}
+
+	dm, err := eval.Evaluate(s, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	best := vdl[0]
+	for _, d := range vdl {
+		if dm[d] > dm[best] {
+			best = d
+		}
+	}
+
+	return best, nil
+}
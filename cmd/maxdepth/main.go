@@ -8,6 +8,10 @@
 //  * deciding whether to pick up
 //  * deciding whether to drop
 //  * deciding whether to turn around
+//
+// With the -distinct flag, states are deduplicated by their canonical key
+// under the configured equivalences, which also reports the number of
+// distinct states reachable in the first round.
 package main
 
 import (
@@ -15,6 +19,7 @@ import (
 	"fmt"
 	"os"
 	"runtime/pprof"
+	"strings"
 	"time"
 
 	"github.com/bubblyworld/deep-sea-adventure/state"
@@ -26,6 +31,18 @@ var players = flag.Int("players", 6,
 var profile = flag.String("profile", "",
 	"file to write CPU profile to if desired")
 
+var distinct = flag.Bool("distinct", false,
+	"deduplicate states by canonical key and count the distinct ones")
+
+var equiv = flag.String("equiv", "type,stash,finished",
+	"comma-separated equivalences to use with -distinct (type, stash, finished)")
+
+var equivalences = map[string]state.Equivalence{
+	"type":     state.EquivalenceTreasureType,
+	"stash":    state.EquivalenceStashOrder,
+	"finished": state.EquivalenceFinishedPlayers,
+}
+
 func main() {
 	flag.Parse()
 
@@ -43,6 +60,31 @@ func main() {
 		}()
 	}
 
+	if *distinct {
+		var eq state.Equivalence
+		for _, name := range strings.Split(*equiv, ",") {
+			if name == "" {
+				continue
+			}
+
+			e, ok := equivalences[name]
+			if !ok {
+				panic(fmt.Sprintf("unknown equivalence %q", name))
+			}
+			eq |= e
+		}
+
+		seen := make(map[state.Key]int)
+		max, err := doDistinct(s, eq, seen)
+		if err != nil {
+			panic(err)
+		}
+
+		fmt.Printf("Max depth achieved: %d\n", max)
+		fmt.Printf("Distinct states: %d\n", len(seen))
+		return
+	}
+
 	max, err := do(s, 0)
 	if err != nil {
 		panic(err)
@@ -78,3 +120,42 @@ func do(s state.State, depth int) (int, error) {
 
 	return max, nil
 }
+
+// doDistinct returns the max number of decisions remaining in the first round
+// from the given state, memoising results by canonical key. All of the
+// supported equivalences are sound within a single round, so equivalent
+// states always have the same number of decisions remaining.
+func doDistinct(s state.State, eq state.Equivalence, seen map[state.Key]int) (
+	int, error) {
+
+	if s.Round() > 1 { // we only care about a single round
+		return 0, nil
+	}
+
+	k := state.Canonical(s, eq)
+	if max, ok := seen[k]; ok {
+		return max, nil
+	}
+
+	max := 0
+	for _, d := range s.ValidDecisions() {
+		if err := s.Do(d); err != nil {
+			return 0, err
+		}
+
+		childMax, err := doDistinct(s, eq, seen)
+		if err != nil {
+			return 0, err
+		}
+		if childMax+1 > max {
+			max = childMax + 1
+		}
+
+		if err := s.Undo(); err != nil {
+			return 0, err
+		}
+	}
+
+	seen[k] = max
+	return max, nil
+}
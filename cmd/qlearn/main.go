@@ -0,0 +1,107 @@
+// Package main trains a table of when to turn around, pick up and drop
+// treasure by playing games against an opponent strategy, and prints the
+// learning curve of the table's strategy against each of the baseline
+// strategies. The table can be saved and trained further later.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bubblyworld/deep-sea-adventure/game"
+	"github.com/bubblyworld/deep-sea-adventure/learn"
+)
+
+var players = flag.Int("players", 3,
+	"number of players in each game")
+
+var opponent = flag.String("opponent", "cautious",
+	"strategy the table learns against, one of "+
+		strings.Join(game.StrategyNames, ", "))
+
+var games = flag.Int("games", 10000,
+	"number of games to learn from")
+
+var epsilon = flag.Float64("epsilon", 0.1,
+	"probability of exploring with a random choice")
+
+var checkpoints = flag.Int("checkpoints", 10,
+	"number of points on the learning curve")
+
+var evalGames = flag.Int("eval", 100,
+	"games to play against each baseline at each checkpoint")
+
+var in = flag.String("in", "",
+	"file of a table to continue training")
+
+var out = flag.String("out", "",
+	"file to save the table to")
+
+var seed = flag.Int64("seed", 1,
+	"seed for the dice, exploration and random strategies")
+
+func main() {
+	flag.Parse()
+
+	rng := rand.New(rand.NewSource(*seed))
+	opp, err := game.Named(*opponent, rng)
+	if err != nil {
+		fail(err)
+	}
+
+	t := learn.NewQTable()
+	if *in != "" {
+		if t, err = learn.LoadQTable(*in); err != nil {
+			fail(err)
+		}
+	}
+
+	curve, err := t.Train(learn.TrainOptions{
+		Games:       *games,
+		Players:     *players,
+		Opponent:    opp,
+		Epsilon:     *epsilon,
+		Checkpoints: *checkpoints,
+		EvalGames:   *evalGames,
+		Seed:        *seed,
+	})
+	if err != nil {
+		fail(err)
+	}
+
+	var names []string
+	for name := range curve[0].Versus {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Printf("%8s", "games")
+	for _, name := range names {
+		fmt.Printf(" %19s", "vs "+name)
+	}
+	fmt.Printf("\n")
+	for _, p := range curve {
+		fmt.Printf("%8d", p.Games)
+		for _, name := range names {
+			v := p.Versus[name]
+			fmt.Printf("     %6.2f / %6.2f", v.Learned, v.Baseline)
+		}
+		fmt.Printf("\n")
+	}
+	fmt.Printf("%d situations learned\n", t.Len())
+
+	if *out != "" {
+		if err := t.Save(*out); err != nil {
+			fail(err)
+		}
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
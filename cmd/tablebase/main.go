@@ -0,0 +1,61 @@
+// Package main generates an endgame tablebase, which holds the exact values
+// of every position within some bounds for the rest of their round. The
+// tablebase is written to a file that can be loaded with eval.LoadTablebase
+// and probed by searches through eval.Options.
+//
+// The number of positions grows very quickly with the bounds, so it's best
+// to start small and work upwards.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bubblyworld/deep-sea-adventure/eval"
+)
+
+var tiles = flag.Int("tiles", 2,
+	"maximum number of tiles on the board, not counting the submarine")
+
+var divers = flag.Int("divers", 2,
+	"maximum number of players at sea (at most 2)")
+
+var stacks = flag.Int("stacks", 1,
+	"maximum number of stacks held by each diver")
+
+var air = flag.Int("air", 4,
+	"maximum air left")
+
+var out = flag.String("out", "tablebase.dat",
+	"file to write the tablebase to")
+
+func main() {
+	flag.Parse()
+
+	start := time.Now()
+	tb, err := eval.GenerateTablebase(eval.TablebaseBounds{
+		Tiles:  *tiles,
+		Divers: *divers,
+		Stacks: *stacks,
+		Air:    *air,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	n, err := tb.WriteTo(f)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("wrote %d positions (%d bytes) to %s in %s\n",
+		tb.Len(), n, *out, time.Since(start))
+}
@@ -0,0 +1,110 @@
+// Package main fits a linear value model to self-play games and reports how
+// well it predicts the outcomes of positions, both for the games it was
+// trained on and for a separate set of validation games. The errors of the
+// hand-tuned heuristic and of always predicting the mean outcome are
+// reported alongside for comparison.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+
+	"github.com/bubblyworld/deep-sea-adventure/eval"
+	"github.com/bubblyworld/deep-sea-adventure/game"
+	"github.com/bubblyworld/deep-sea-adventure/learn"
+)
+
+var players = flag.Int("players", 3,
+	"number of players in each game")
+
+var strategy = flag.String("strategy", "cautious",
+	"strategy played by every seat, one of "+
+		strings.Join(game.StrategyNames, ", "))
+
+var games = flag.Int("games", 500,
+	"number of self-play games to train on")
+
+var validation = flag.Int("validation", 100,
+	"number of self-play games to validate on")
+
+var ridge = flag.Float64("ridge", 1e-3,
+	"weight of the ridge penalty on the model's feature weights")
+
+var out = flag.String("out", "",
+	"file to save the model to")
+
+var seed = flag.Int64("seed", 1,
+	"seed for the dice and random strategies")
+
+func main() {
+	flag.Parse()
+
+	rng := rand.New(rand.NewSource(*seed))
+	sl := make([]game.Strategy, *players)
+	for i := range sl {
+		var err error
+		if sl[i], err = game.Named(*strategy, rng); err != nil {
+			fail(err)
+		}
+	}
+
+	train, err := learn.Generate(sl, learn.GenerateOptions{
+		Games: *games,
+		Seed:  *seed,
+	})
+	if err != nil {
+		fail(err)
+	}
+	valid, err := learn.Generate(sl, learn.GenerateOptions{
+		Games: *validation,
+		Seed:  ^*seed,
+	})
+	if err != nil {
+		fail(err)
+	}
+
+	m, err := learn.Fit(train, *ridge)
+	if err != nil {
+		fail(err)
+	}
+
+	var mean float64
+	for _, smp := range train {
+		mean += smp.Outcome
+	}
+	baselines := []struct {
+		name  string
+		model *learn.Model
+	}{
+		{"model", m},
+		{"heuristic", &learn.Model{Weights: eval.DefaultWeights()}},
+		{"mean", &learn.Model{Bias: mean / float64(len(train))}},
+	}
+
+	fmt.Printf("%d training and %d validation samples\n", len(train),
+		len(valid))
+	for _, b := range baselines {
+		fmt.Printf("%-10s train mse %8.3f, validation mse %8.3f\n", b.name,
+			b.model.Error(train), b.model.Error(valid))
+	}
+
+	fmt.Printf("weights:\n")
+	for _, f := range eval.Features {
+		fmt.Printf("\t%-15s %8.4f\n", f.Name, m.Weights[f.Name])
+	}
+	fmt.Printf("\t%-15s %8.4f\n", "bias", m.Bias)
+
+	if *out != "" {
+		if err := m.Save(*out); err != nil {
+			fail(err)
+		}
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
@@ -0,0 +1,339 @@
+package eval
+
+import (
+	"math"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+)
+
+// evaluatePruned is equivalent to evaluate for paranoid searches, but prunes
+// the game tree using alpha/beta bounds. Each decision is searched with a full
+// window so that the resulting values are exact.
+func (sr *searcher) evaluatePruned(s state.State, depth int) (
+	map[state.Decision]float64, error) {
+
+	return sr.rootValues(s, func(sr *searcher, s state.State) (float64, error) {
+		return sr.alphabeta(s, depth-1, math.Inf(-1), math.Inf(1), nil)
+	})
+}
+
+// alphabeta returns the player's value of the given state in a paranoid
+// search, pruning decisions that can't affect the result. If the returned
+// value is at most alpha it is an upper bound on the true value, and if it is
+// at least beta it is a lower bound. Otherwise it is exact.
+//
+// Choice stages are pruned with fail-soft alpha/beta. Chance stages are
+// pruned with Ballard's Star1 and Star2 algorithms, which rely on bounds on
+// the utility of the player (see Utility). If non-nil, the hint is used in
+// place of searching the first valid decision where possible.
+func (sr *searcher) alphabeta(s state.State, depth int, alpha, beta float64,
+	h *hint) (float64, error) {
+
+	if err := sr.check(); err != nil {
+		return 0, err
+	}
+
+	sr.stats.Nodes++
+	vl, err := sr.cached(s, depth, true, alpha, beta,
+		func() ([]float64, error) {
+			v, err := sr.computeAlphabeta(s, depth, alpha, beta, h)
+			return []float64{v}, err
+		})
+	if err != nil {
+		return 0, err
+	}
+
+	return vl[0], nil
+}
+
+// computeAlphabeta is alphabeta without the transposition table.
+func (sr *searcher) computeAlphabeta(s state.State, depth int,
+	alpha, beta float64, h *hint) (float64, error) {
+
+	if sr.isLeaf(s, depth) {
+		ul, err := sr.leaf(s, depth)
+		if err != nil {
+			return 0, err
+		}
+
+		return ul[sr.player], nil
+	}
+
+	// The bounds alone may be enough to cut off the search.
+	lo, hi := sr.utility.Bounds(s, sr.player)
+	if lo == hi || hi <= alpha || lo >= beta {
+		sr.stats.Cutoffs++
+		if hi <= alpha {
+			return hi, nil
+		}
+
+		return lo, nil
+	}
+
+	if s.Stage() == state.StageRoll {
+		return sr.chance(s, depth, alpha, beta)
+	}
+
+	// Modelled opponents aren't pruned, since every decision they might
+	// make contributes to the expectation.
+	if sr.modelled(s) {
+		v, err := sr.expectation(s, func() ([]float64, error) {
+			v, err := sr.alphabeta(s, depth-1, math.Inf(-1), math.Inf(1), nil)
+			return []float64{v}, err
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		return v[0], nil
+	}
+
+	maximise := s.CurrentPlayer() == sr.player
+	best := math.Inf(1)
+	if maximise {
+		best = math.Inf(-1)
+	}
+
+	for i, vd := range s.ValidDecisions() {
+		var v float64
+		if i == 0 && h.usable(maximise, alpha, beta) {
+			v = h.value(maximise)
+			sr.truncated = sr.truncated || h.truncated
+		} else {
+			if err := s.Do(vd); err != nil {
+				return 0, err
+			}
+
+			var err error
+			v, err = sr.alphabeta(s, depth-1, alpha, beta, nil)
+			if err := s.Undo(); err != nil {
+				return 0, err
+			}
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		if maximise {
+			best = math.Max(best, v)
+			alpha = math.Max(alpha, v)
+		} else {
+			best = math.Min(best, v)
+			beta = math.Min(beta, v)
+		}
+
+		if alpha >= beta {
+			sr.stats.Cutoffs++
+			break
+		}
+	}
+
+	return best, nil
+}
+
+// chance returns the player's value of the given roll stage, with the same
+// semantics as alphabeta. Each roll's value is bounded using bounds, and then
+// tightened by probing a single decision of its resulting choice stage (Star2)
+// before the rolls are searched in full with narrowed windows (Star1).
+func (sr *searcher) chance(s state.State, depth int, alpha, beta float64) (
+	float64, error) {
+
+	vdl := s.ValidDecisions()
+	pl := make([]float64, len(vdl))
+	lbs := make([]float64, len(vdl))
+	ubs := make([]float64, len(vdl))
+	hints := make([]*hint, len(vdl))
+	// lower and upper return bounds on the chance stage's value from the
+	// current per-roll bounds.
+	lower := func() float64 { return dot(pl, lbs) }
+	upper := func() float64 { return dot(pl, ubs) }
+
+	for i, vd := range vdl {
+		if err := s.Do(vd); err != nil {
+			return 0, err
+		}
+
+		pl[i] = rollProbability(vd)
+		lbs[i], ubs[i] = sr.utility.Bounds(s, sr.player)
+		if err := s.Undo(); err != nil {
+			return 0, err
+		}
+	}
+
+	// Star2 probing phase.
+	for i, vd := range vdl {
+		if err := s.Do(vd); err != nil {
+			return 0, err
+		}
+
+		h, err := sr.probe(s, depth-1, i, pl, lbs, ubs, alpha, beta)
+		if err := s.Undo(); err != nil {
+			return 0, err
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		hints[i] = h
+	}
+
+	if lb := lower(); lb >= beta {
+		sr.stats.Cutoffs++
+		return lb, nil
+	}
+	if ub := upper(); ub <= alpha {
+		sr.stats.Cutoffs++
+		return ub, nil
+	}
+
+	// Star1 search phase. As rolls are searched, their bounds are replaced
+	// by their actual values.
+	for i, vd := range vdl {
+		if lb := lower(); lb >= beta {
+			sr.stats.Cutoffs++
+			return lb, nil
+		}
+		if ub := upper(); ub <= alpha {
+			sr.stats.Cutoffs++
+			return ub, nil
+		}
+
+		// The window in which this roll's value affects the result.
+		restLo := lower() - pl[i]*lbs[i]
+		restHi := upper() - pl[i]*ubs[i]
+		ca := math.Max((alpha-restHi)/pl[i], lbs[i])
+		cb := math.Min((beta-restLo)/pl[i], ubs[i])
+
+		if err := s.Do(vd); err != nil {
+			return 0, err
+		}
+
+		v, err := sr.alphabeta(s, depth-1, ca, cb, hints[i])
+		if err := s.Undo(); err != nil {
+			return 0, err
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		// If the roll's value fell outside of the window, then it's only a
+		// bound - unless the window was clamped to the roll's own bounds, in
+		// which case it must be exact.
+		v = math.Min(math.Max(v, lbs[i]), ubs[i])
+		if v <= ca {
+			ubs[i] = v
+			if ub := upper(); ub <= alpha {
+				sr.stats.Cutoffs++
+				return ub, nil
+			}
+		}
+		if v >= cb {
+			lbs[i] = v
+			if lb := lower(); lb >= beta {
+				sr.stats.Cutoffs++
+				return lb, nil
+			}
+		}
+
+		lbs[i], ubs[i] = v, v
+	}
+
+	return lower(), nil
+}
+
+// probe tightens the bounds on the player's value of the given state, which
+// is the result of roll i of a chance stage. If it's a choice stage, a single
+// decision is searched to tighten one of the bounds: a lower bound if the
+// player is choosing, or an upper bound if an adversary is choosing. The
+// result of the search is returned as a hint for searching the state again.
+func (sr *searcher) probe(s state.State, depth, i int, pl, lbs, ubs []float64,
+	alpha, beta float64) (*hint, error) {
+
+	lo, hi := lbs[i], ubs[i]
+	if sr.isLeaf(s, depth) || s.Stage() == state.StageRoll || lo == hi ||
+		sr.modelled(s) {
+		return nil, nil
+	}
+
+	// The window in which this roll's value affects the chance stage.
+	ca := (alpha - (dot(pl, ubs) - pl[i]*hi)) / pl[i]
+	cb := (beta - (dot(pl, lbs) - pl[i]*lo)) / pl[i]
+
+	// Whether the player is choosing depends on this state, not on the one
+	// that results from the probed decision.
+	maximise := s.CurrentPlayer() == sr.player
+	if err := s.Do(s.ValidDecisions()[0]); err != nil {
+		return nil, err
+	}
+
+	// Searching with the state's own bound on one side of the window means
+	// that any result is a valid bound on that side.
+	h := &hint{lo: lo, hi: hi}
+	truncated := sr.truncated
+	sr.truncated = false
+	var v float64
+	var err error
+	if maximise {
+		v, err = sr.alphabeta(s, depth-1, lo, math.Max(cb, lo), nil)
+		if v = math.Min(math.Max(v, lo), hi); v < cb {
+			h.hi = v
+		}
+		h.lo = v
+		lbs[i] = v
+	} else {
+		v, err = sr.alphabeta(s, depth-1, math.Min(ca, hi), hi, nil)
+		if v = math.Min(math.Max(v, lo), hi); v > ca {
+			h.lo = v
+		}
+		h.hi = v
+		ubs[i] = v
+	}
+
+	h.truncated = sr.truncated
+	sr.truncated = sr.truncated || truncated
+
+	if err := s.Undo(); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// hint is the result of a previous search of the first valid decision of a
+// state, given as an interval that contains the decision's true value.
+type hint struct {
+	lo, hi    float64
+	truncated bool // whether the search ran out of depth
+}
+
+// usable returns true if the hint can be used in place of searching the
+// decision with the given window.
+func (h *hint) usable(maximise bool, alpha, beta float64) bool {
+	if h == nil {
+		return false
+	}
+
+	return h.lo == h.hi || (maximise && h.lo >= beta) ||
+		(!maximise && h.hi <= alpha)
+}
+
+// value returns the value to use for the decision if the hint is usable.
+func (h *hint) value(maximise bool) float64 {
+	if maximise {
+		return h.lo
+	}
+
+	return h.hi
+}
+
+func dot(a, b []float64) float64 {
+	var res float64
+	for i := range a {
+		res += a[i] * b[i]
+	}
+
+	return res
+}
@@ -0,0 +1,106 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPruning checks that pruning doesn't change the values of decisions in
+// endgames that can be searched exactly, and that it visits fewer states.
+func TestPruning(t *testing.T) {
+	cases := []struct {
+		name string
+		dl   []state.Decision
+	}{
+		{
+			name: "roll",
+		},
+		{
+			name: "drop",
+			dl:   []state.Decision{state.Roll(2)},
+		},
+		{
+			name: "opponent",
+			dl:   []state.Decision{state.Roll(3)},
+		},
+	}
+
+	var pruned, full Stats
+	for _, c := range cases {
+		c := c
+
+		t.Run(c.name, func(t *testing.T) {
+			s := endgame(t)
+			do(t, s, c.dl...)
+
+			exp, err := Evaluate(s, Options{
+				Depth:          100,
+				DisablePruning: true,
+				Stats:          &full,
+			})
+			require.NoError(t, err)
+
+			dm, err := Evaluate(s, Options{Depth: 100, Stats: &pruned})
+			require.NoError(t, err)
+
+			require.Len(t, dm, len(exp))
+			for d, eval := range exp {
+				assert.InDelta(t, eval, dm[d], 1e-9, "decision %s", d)
+			}
+		})
+	}
+
+	t.Logf("pruned: %+v, full: %+v", pruned, full)
+	assert.True(t, pruned.Nodes < full.Nodes)
+	assert.True(t, pruned.Cutoffs > 0)
+	assert.Zero(t, full.Cutoffs)
+}
+
+// TestPruningTruncated checks that pruning doesn't change the values of
+// decisions in random positions from the middle of the round, searched to
+// depths at which the leaf evaluator is used. Leaves aren't solved, so that
+// they're all evaluated by the leaf evaluator.
+func TestPruningTruncated(t *testing.T) {
+	leaves := []struct {
+		name string
+		leaf LeafEvaluator
+	}{
+		{"heuristic", Heuristic{}},
+		{"featured", Featured{}},
+		{"rollouts", Rollouts{Iterations: 10}},
+	}
+
+	rng := newRand(1, 0)
+	for players := 2; players <= 4; players++ {
+		for game := 0; game < 4; game++ {
+			s := state.NewStandardState(players)
+			for turns := 4 + rng.Intn(12); turns > 0 && s.Round() == 1; turns-- {
+				vdl := s.ValidDecisions()
+				require.NoError(t, s.Do(vdl[rng.Intn(len(vdl))]))
+			}
+
+			for depth := 2; depth <= 4; depth++ {
+				for _, l := range leaves {
+					opts := Options{Depth: depth, Leaf: l.leaf, Seed: 1,
+						DisableSolver: true, DisablePruning: true}
+					exp, err := Evaluate(s, opts)
+					require.NoError(t, err)
+
+					opts.DisablePruning = false
+					dm, err := Evaluate(s, opts)
+					require.NoError(t, err)
+
+					require.Len(t, dm, len(exp))
+					for d, eval := range exp {
+						assert.InDelta(t, eval, dm[d], 1e-9,
+							"%d players, depth %d, %s leaves, decision %s",
+							players, depth, l.name, d)
+					}
+				}
+			}
+		}
+	}
+}
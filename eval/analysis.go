@@ -0,0 +1,322 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+)
+
+// Size of the transposition table used by Analyse if the options don't have
+// one, which is needed to compute principal variations cheaply.
+const analysisTableSize = 1 << 16
+
+// Number of nodes that may be searched to recover each principal variation,
+// which is mostly made up of transposition table hits.
+const variationNodes = 1 << 14
+
+// Analysis is a detailed account of a search, for debugging recommendations.
+type Analysis struct {
+	Player   int           // player the decisions were evaluated for
+	Moves    []Move        // valid decisions, best first
+	Depth    int           // depth of the deepest completed search
+	Complete bool          // whether every line was searched to the horizon
+	Stats    Stats         // work done over every iteration of the search
+	Elapsed  time.Duration // time taken by the search
+}
+
+// Move is the analysis of a single decision.
+type Move struct {
+	Decision state.Decision
+	Value    float64 // value of the decision for the player
+
+	// PV is the principal variation, which is the line of play the search
+	// expects to follow the decision, up to where the search stopped.
+	// Chance stages are followed by their most likely roll.
+	PV []state.Decision
+
+	// Exact is true if every line following the decision was searched to
+	// the horizon, so that its value wasn't estimated by the leaf
+	// evaluator.
+	Exact bool
+
+	// DepthChange is how much the value changed from the previous depth of
+	// the search. It isn't a statistical measure of uncertainty, and says
+	// nothing about the noise of the leaf evaluator, but values that are
+	// still moving between depths are less likely to be settled. It's zero
+	// if the search completed at the first depth.
+	DepthChange float64
+
+	// Stats is the work done searching the decision.
+	Stats Stats
+}
+
+// Analyse is like EvaluateContext, but returns an analysis of the search
+// rather than just the value of each decision. Principal variations are
+// recovered from the transposition table after the search, so a table is
+// used even if the options don't have one, and stats are only incremented
+// with the work done by the search itself.
+func Analyse(ctx context.Context, s state.State, opts Options) (
+	*Analysis, error) {
+
+	start := time.Now()
+	if opts.Table == nil {
+		opts.Table = NewTable(analysisTableSize)
+	}
+
+	var stats Stats
+	outer := opts.Stats
+	opts.Stats = &stats
+	defer func() {
+		if outer != nil {
+			outer.add(&stats)
+		}
+	}()
+
+	sr, err := newSearcher(ctx, s, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	vdl := s.ValidDecisions()
+	sr.roots = make(map[state.Decision]*root)
+	for _, vd := range vdl {
+		sr.roots[vd] = new(root)
+	}
+
+	a := Analysis{Player: sr.player}
+	var prev, best map[state.Decision]float64
+	exact := make(map[state.Decision]bool)
+	err = sr.deepen(s, opts, func(dm map[state.Decision]float64, depth int) {
+		prev, best = best, dm
+		a.Depth, a.Complete = depth, !sr.truncated
+		for d, r := range sr.roots {
+			exact[d] = !r.truncated
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	a.Stats, a.Elapsed = stats, time.Since(start)
+	for _, vd := range vdl {
+		m := Move{
+			Decision: vd,
+			Value:    best[vd],
+			Exact:    exact[vd],
+			Stats:    sr.roots[vd].stats,
+		}
+		if prev != nil {
+			m.DepthChange = best[vd] - prev[vd]
+		}
+
+		// The principal variation is recovered with a separate searcher, so
+		// that it doesn't add to the stats of the search. The search usually
+		// stops because the context is done, so recovery has its own budget
+		// of nodes instead.
+		pv := *sr
+		pv.ctx = context.Background()
+		pv.maxNodes = variationNodes
+		pv.stats = new(Stats)
+		pv.roots = nil
+		pruned := opts.Mode == ModeParanoid && !opts.DisablePruning
+		if m.PV, err = pv.variation(s, vd, a.Depth-1, pruned); err != nil {
+			return nil, err
+		}
+
+		a.Moves = append(a.Moves, m)
+	}
+
+	sort.SliceStable(a.Moves, func(i, j int) bool {
+		return a.Moves[i].Value > a.Moves[j].Value
+	})
+
+	return &a, nil
+}
+
+// Values returns a map of the analysed decisions to their values, as
+// returned by Evaluate.
+func (a *Analysis) Values() map[state.Decision]float64 {
+	dm := make(map[state.Decision]float64)
+	for _, m := range a.Moves {
+		dm[m.Decision] = m.Value
+	}
+
+	return dm
+}
+
+// String formats the analysis as a table of moves, best first.
+func (a *Analysis) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "player %d, depth %d", a.Player, a.Depth)
+	if a.Complete {
+		fmt.Fprintf(&b, " (complete)")
+	}
+	fmt.Fprintf(&b, ", %d nodes, %d leaves, %d hits, %s\n", a.Stats.Nodes,
+		a.Stats.Leaves, a.Stats.Hits, a.Elapsed.Round(time.Millisecond))
+
+	for i, m := range a.Moves {
+		change := "exact"
+		if !m.Exact {
+			change = fmt.Sprintf("%+.4f", m.DepthChange)
+		}
+
+		pv := make([]string, len(m.PV))
+		for j, d := range m.PV {
+			pv[j] = d.String()
+		}
+
+		fmt.Fprintf(&b, "%2d. %-14s %9.4f %9s %8d nodes %7d leaves  %s\n",
+			i+1, m.Decision, m.Value, change, m.Stats.Nodes,
+			m.Stats.Leaves, strings.Join(pv, " "))
+	}
+
+	return b.String()
+}
+
+// root records the work done below a root decision of a search.
+type root struct {
+	stats     Stats
+	truncated bool // whether the search below it ran out of depth
+}
+
+// variation returns the principal variation following the given decision,
+// which is searched to the given depth. Each state on the line is followed by
+// the decision that the search would make in it, except for rolls, which are
+// followed by the most likely roll. If the searcher runs out of nodes or its
+// context is done, the line found so far is returned. The state is restored
+// before returning.
+func (sr *searcher) variation(s state.State, d state.Decision, depth int,
+	pruned bool) ([]state.Decision, error) {
+
+	if err := s.Do(d); err != nil {
+		return nil, err
+	}
+
+	pv := []state.Decision{d}
+	defer func() {
+		for range pv {
+			s.Undo()
+		}
+	}()
+
+	for ; !sr.isLeaf(s, depth); depth-- {
+		next, err := sr.principal(s, depth, pruned)
+		if err != nil && (err == errNodeLimit || err == sr.ctx.Err()) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := s.Do(next); err != nil {
+			return nil, err
+		}
+		pv = append(pv, next)
+	}
+
+	return append([]state.Decision(nil), pv...), nil
+}
+
+// principal returns the decision the search would make in the given state,
+// or the most likely roll if it's a chance stage. In best-reply searches, the
+// searcher's adversary is updated to whichever opponent replies on the line.
+func (sr *searcher) principal(s state.State, depth int, pruned bool) (
+	state.Decision, error) {
+
+	if sr.bestReply {
+		switch cp := s.CurrentPlayer(); {
+		case cp == sr.player:
+			sr.adversary = adversaryNone
+
+		case sr.adversary == adversaryNone:
+			replier, _, err := sr.replier(s, depth)
+			if err != nil {
+				return 0, err
+			}
+
+			sr.adversary = replier
+		}
+
+		if sr.passive(s) {
+			return passivePolicy.Decide(s, nil)
+		}
+	}
+
+	vdl := s.ValidDecisions()
+	if s.Stage() == state.StageRoll {
+		best := vdl[0]
+		for _, vd := range vdl {
+			if rollProbability(vd) > rollProbability(best) {
+				best = vd
+			}
+		}
+
+		return best, nil
+	}
+
+	// Modelled opponents are followed by their most likely decision.
+	if sr.modelled(s) {
+		vdl, pl, err := sr.distribution(s)
+		if err != nil {
+			return 0, err
+		}
+
+		best := 0
+		for i := range vdl {
+			if pl[i] > pl[best] {
+				best = i
+			}
+		}
+
+		return vdl[best], nil
+	}
+
+	// Values of the children are computed as in the search, so that they're
+	// mostly found in the transposition table.
+	cp := s.CurrentPlayer()
+	adversarial := cp != sr.player &&
+		(sr.adversary == adversaryAll || sr.adversary == cp)
+
+	var best state.Decision
+	bestValue := math.Inf(-1)
+	for _, vd := range vdl {
+		if err := s.Do(vd); err != nil {
+			return 0, err
+		}
+
+		var v float64
+		var err error
+		if pruned {
+			v, err = sr.alphabeta(s, depth-1, math.Inf(-1), math.Inf(1), nil)
+		} else {
+			var vl []float64
+			if vl, err = sr.value(s, depth-1); err == nil {
+				v = vl[cp]
+				if adversarial {
+					v = vl[sr.player]
+				}
+			}
+		}
+		if err := s.Undo(); err != nil {
+			return 0, err
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		// Adversaries minimise the player's value.
+		if adversarial {
+			v = -v
+		}
+		if v > bestValue {
+			best, bestValue = vd, v
+		}
+	}
+
+	return best, nil
+}
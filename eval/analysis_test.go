@@ -0,0 +1,147 @@
+package eval
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyse(t *testing.T) {
+	s := endgame(t)
+	require.NoError(t, s.Do(state.Roll(2))) // player 0 has a drop decision
+	key := state.Canonical(s, 0)
+
+	modes := []Mode{ModeParanoid, ModeMaxN, ModeBestReply}
+	for _, mode := range modes {
+		for _, disable := range []bool{false, true} {
+			opts := Options{Depth: 100, Mode: mode, DisablePruning: disable}
+			exp, err := Evaluate(s, opts)
+			require.NoError(t, err)
+
+			var stats Stats
+			opts.Stats = &stats
+			a, err := Analyse(context.Background(), s, opts)
+			require.NoError(t, err)
+			assert.Equal(t, key, state.Canonical(s, 0))
+			assert.Equal(t, a.Stats, stats)
+			assert.True(t, a.Complete)
+			assert.Equal(t, 0, a.Player)
+
+			require.Len(t, a.Moves, len(exp))
+			var nodes int
+			for i, m := range a.Moves {
+				assert.InDelta(t, exp[m.Decision], m.Value, 1e-9)
+				assert.True(t, m.Exact)
+				if i > 0 {
+					assert.True(t, m.Value <= a.Moves[i-1].Value)
+				}
+				nodes += m.Stats.Nodes
+
+				// Principal variations are valid lines of play that start
+				// with the decision.
+				require.NotEmpty(t, m.PV)
+				assert.Equal(t, m.Decision, m.PV[0])
+				do(t, s, m.PV...)
+				for range m.PV {
+					require.NoError(t, s.Undo())
+				}
+			}
+			assert.Equal(t, a.Stats.Nodes, nodes)
+
+			out := a.String()
+			for _, m := range a.Moves {
+				assert.True(t, strings.Contains(out, m.Decision.String()))
+			}
+		}
+	}
+}
+
+// TestVariationContext checks that principal variations stop where they are
+// when the search's context is done, rather than running past it.
+func TestVariationContext(t *testing.T) {
+	s := state.NewStandardState(2)
+	opts := Options{Mode: ModeMaxN, Leaf: new(constant),
+		Table: NewTable(1 << 16)}
+	d := state.Roll(3)
+
+	sr, err := newSearcher(context.Background(), s, opts)
+	require.NoError(t, err)
+	full, err := sr.variation(s, d, 4, false)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	opts.Table = NewTable(1 << 16)
+	sr, err = newSearcher(ctx, s, opts)
+	require.NoError(t, err)
+	pv, err := sr.variation(s, d, 4, false)
+	require.NoError(t, err)
+	assert.Equal(t, []state.Decision{d}, pv)
+	assert.True(t, len(full) > 1)
+}
+
+// TestAnalyseDeadline checks that principal variations are recovered past the
+// root decision when the search is stopped by its context's deadline.
+func TestAnalyseDeadline(t *testing.T) {
+	s := state.NewStandardState(3)
+	ctx, cancel := context.WithTimeout(context.Background(),
+		100*time.Millisecond)
+	defer cancel()
+
+	a, err := Analyse(ctx, s, Options{Mode: ModeMaxN, Leaf: new(constant)})
+	require.NoError(t, err)
+	require.True(t, a.Depth > 1)
+	assert.False(t, a.Complete)
+	for _, m := range a.Moves {
+		assert.True(t, len(m.PV) > 1)
+	}
+}
+
+// TestAnalyseTruncated checks that moves are only exact if they were searched
+// to the horizon, and that principal variations stop where the search did.
+func TestAnalyseTruncated(t *testing.T) {
+	s := state.NewStandardState(3)
+	a, err := Analyse(context.Background(), s,
+		Options{Depth: 3, Mode: ModeMaxN, Leaf: new(constant)})
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, a.Depth)
+	assert.False(t, a.Complete)
+	for _, m := range a.Moves {
+		assert.False(t, m.Exact)
+		assert.Len(t, m.PV, 3)
+		assert.True(t, m.Stats.Leaves > 0)
+	}
+}
+
+// TestAnalyseDepthChange checks that each move's depth change is the
+// difference between its values at the last two depths of the search.
+func TestAnalyseDepthChange(t *testing.T) {
+	s := state.NewStandardState(3)
+	rng := newRand(1, 0)
+	for turns := 0; turns < 8; turns++ {
+		vdl := s.ValidDecisions()
+		require.NoError(t, s.Do(vdl[rng.Intn(len(vdl))]))
+	}
+
+	opts := Options{Depth: 4, Mode: ModeMaxN, Leaf: Rollouts{Iterations: 20},
+		Seed: 1}
+	a, err := Analyse(context.Background(), s, opts)
+	require.NoError(t, err)
+
+	exp, err := Evaluate(s, opts)
+	require.NoError(t, err)
+	opts.Depth--
+	prev, err := Evaluate(s, opts)
+	require.NoError(t, err)
+
+	for _, m := range a.Moves {
+		assert.InDelta(t, exp[m.Decision]-prev[m.Decision], m.DepthChange,
+			1e-9, "decision %s", m.Decision)
+	}
+}
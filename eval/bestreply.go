@@ -0,0 +1,90 @@
+package eval
+
+import (
+	"github.com/bubblyworld/deep-sea-adventure/state"
+)
+
+// reply returns the value of the given state in a best-reply search, and true,
+// if it's handled differently from max-n search. The opponents' turns between
+// two of the player's turns are a single reply: when they start, the search
+// branches on which opponent replies, and takes whichever is worst for the
+// player. The replying opponent then minimises the player's value as in a
+// paranoid search, while the other opponents make the decisions of the passive
+// policy. Modelled opponents still make decisions with their models, and are
+// never chosen to reply.
+func (sr *searcher) reply(s state.State, depth int) ([]float64, bool, error) {
+	cp := s.CurrentPlayer()
+	switch {
+	case cp == sr.player && sr.adversary != adversaryNone:
+		// The player's turn ends the reply.
+		adversary := sr.adversary
+		sr.adversary = adversaryNone
+		v, err := sr.value(s, depth)
+		sr.adversary = adversary
+
+		return v, true, err
+
+	case cp != sr.player && sr.adversary == adversaryNone:
+		_, v, err := sr.replier(s, depth)
+		return v, v != nil || err != nil, err
+
+	case sr.passive(s):
+		d, err := passivePolicy.Decide(s, nil)
+		if err != nil {
+			return nil, true, err
+		}
+		if err := s.Do(d); err != nil {
+			return nil, true, err
+		}
+
+		v, err := sr.value(s, depth-1)
+		if err := s.Undo(); err != nil {
+			return nil, true, err
+		}
+
+		return v, true, err
+	}
+
+	return nil, false, nil
+}
+
+// replier returns the opponent whose reply is worst for the player in the
+// given state, where the reply starts, along with the resulting value of the
+// state. If no opponent can reply, the value is nil.
+func (sr *searcher) replier(s state.State, depth int) (int, []float64,
+	error) {
+
+	replier := adversaryNone
+	var best []float64
+	for opp, p := range s.Players() {
+		if opp == sr.player || p.Done() || sr.model(opp) != nil {
+			continue
+		}
+
+		sr.adversary = opp
+		v, err := sr.value(s, depth)
+		sr.adversary = adversaryNone
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if best == nil || v[sr.player] < best[sr.player] {
+			replier, best = opp, v
+		}
+	}
+
+	return replier, best, nil
+}
+
+// passivePolicy makes the decisions of opponents in best-reply searches that
+// aren't replying, in place of passing.
+var passivePolicy Policy = Cautious{}
+
+// passive returns true if the decision in the given state is made by an
+// opponent that isn't replying in a best-reply search.
+func (sr *searcher) passive(s state.State) bool {
+	cp := s.CurrentPlayer()
+	return sr.bestReply && cp != sr.player && cp != sr.adversary &&
+		sr.adversary != adversaryNone && s.Stage() != state.StageRoll &&
+		s.Stage() != state.StageEndOfGame && !sr.modelled(s)
+}
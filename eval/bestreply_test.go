@@ -0,0 +1,55 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBestReply checks best-reply search against paranoid search in random
+// positions from the middle of the round. With two players the only opponent
+// always replies, so the searches are the same. With more, every line of a
+// best-reply search is a line that paranoid opponents could choose, so the
+// player can never do worse, and the passive opponents should let them do
+// better somewhere.
+func TestBestReply(t *testing.T) {
+	rng := newRand(1, 0)
+	for players := 2; players <= 4; players++ {
+		var better bool
+		for game := 0; game < 3; game++ {
+			s := state.NewStandardState(players)
+			for turns := 4 + rng.Intn(12); turns > 0 && s.Round() == 1; turns-- {
+				vdl := s.ValidDecisions()
+				require.NoError(t, s.Do(vdl[rng.Intn(len(vdl))]))
+			}
+
+			opts := Options{Depth: 10, Utility: Margin{}, Leaf: Heuristic{},
+				DisableSolver: true}
+			paranoid, err := Evaluate(s, opts)
+			require.NoError(t, err)
+
+			opts.Mode = ModeBestReply
+			reply, err := Evaluate(s, opts)
+			require.NoError(t, err)
+
+			require.Len(t, reply, len(paranoid))
+			for d, eval := range paranoid {
+				if players == 2 {
+					assert.InDelta(t, eval, reply[d], 1e-9,
+						"decision %s", d)
+					continue
+				}
+
+				assert.True(t, eval <= reply[d]+1e-9,
+					"%d players, decision %s", players, d)
+				better = better || eval < reply[d]-1e-9
+			}
+		}
+
+		if players > 2 {
+			assert.True(t, better, "%d players", players)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package eval
+
+import (
+	"math"
+	"sort"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+)
+
+// Default number of random monte-carlo games to consider for utility
+// estimation.
+const estimateIterations = 100
+
+// Default maximum number of random games to play when sampling until a
+// target confidence interval width is reached.
+const estimateMaxIterations = 100 * estimateIterations
+
+// Z-score of a two-sided 95% confidence interval for a normal distribution.
+const z95 = 1.96
+
+// EstimateOptions configures the estimation performed by Estimate.
+type EstimateOptions struct {
+	// Iterations is the number of random games to play, by default the
+	// same number used for leaves of Evaluate.
+	Iterations int
+
+	// LastRound is the round at which random games are stopped, or the end
+	// of the game if it isn't positive.
+	LastRound int
+
+	// Width, if positive, is the target width of the 95% confidence
+	// interval of the estimate. Games are played in batches after the
+	// first Iterations until the target is reached, up to MaxIterations.
+	Width float64
+
+	// MaxIterations is the maximum number of games to play when a target
+	// width is set, by default estimateMaxIterations.
+	MaxIterations int
+
+	// Utility is the utility to estimate, ExpectedScore by default.
+	Utility Utility
+
+	// Policy makes the decisions in random games, Uniform by default.
+	Policy Policy
+
+	// Workers is the number of goroutines to split the random games
+	// between. By default there's one.
+	Workers int
+
+	// Samples, if true, keeps the utility of every random game in the
+	// estimation, so that its distribution can be inspected.
+	Samples bool
+
+	// Seed, if non-zero, seeds the random games so that the estimate is
+	// deterministic regardless of the number of workers.
+	Seed int64
+}
+
+// Estimation is a monte-carlo estimate of a player's expected utility.
+type Estimation struct {
+	Mean     float64 // mean utility over the random games
+	Variance float64 // sample variance of the utility of a random game
+	StdErr   float64 // standard error of the mean
+	N        int     // number of random games played
+
+	// Samples are the utilities the estimate was made from in increasing
+	// order, if they were kept.
+	Samples []float64
+}
+
+// Interval returns an approximate 95% confidence interval for the expected
+// utility, assuming the mean is normally distributed.
+func (e Estimation) Interval() (float64, float64) {
+	return e.Mean - z95*e.StdErr, e.Mean + z95*e.StdErr
+}
+
+// StdDev returns the standard deviation of the utility of a random game,
+// which is a measure of how risky the position is.
+func (e Estimation) StdDev() float64 {
+	return math.Sqrt(e.Variance)
+}
+
+// Quantile returns the q-quantile of the utility of a random game, for q
+// between 0 and 1, interpolating between samples if they were kept.
+// Otherwise the utility is assumed to be normally distributed, or to be the
+// mean if there's no variance.
+func (e Estimation) Quantile(q float64) float64 {
+	if len(e.Samples) > 0 {
+		pos := q * float64(len(e.Samples)-1)
+		i := int(math.Floor(pos))
+		if i >= len(e.Samples)-1 {
+			return e.Samples[len(e.Samples)-1]
+		}
+		if i < 0 {
+			return e.Samples[0]
+		}
+
+		frac := pos - float64(i)
+		return e.Samples[i] + frac*(e.Samples[i+1]-e.Samples[i])
+	}
+
+	if e.Variance == 0 {
+		return e.Mean // every quantile, even for q of 0 or 1
+	}
+
+	return e.Mean + e.StdDev()*math.Sqrt2*math.Erfinv(2*q-1)
+}
+
+// ProbAtLeast returns the probability of the utility of a random game being
+// at least the given target, which is the proportion of samples that reach
+// it if they were kept. Otherwise the utility is assumed to be normally
+// distributed.
+func (e Estimation) ProbAtLeast(target float64) float64 {
+	if len(e.Samples) > 0 {
+		i := sort.SearchFloat64s(e.Samples, target)
+		return float64(len(e.Samples)-i) / float64(len(e.Samples))
+	}
+
+	if e.Variance == 0 {
+		if e.Mean >= target {
+			return 1
+		}
+
+		return 0
+	}
+
+	return math.Erfc((target-e.Mean)/(e.StdDev()*math.Sqrt2)) / 2
+}
+
+// Estimate returns an estimate for the expected utility for the given player
+// in the given board state. Random games are played from the state with rolls
+// sampled from the dice distribution, and decisions made by the rollout
+// policy.
+func Estimate(s state.State, player int, opts EstimateOptions) (
+	Estimation, error) {
+
+	el, err := estimateAll(s, player, opts)
+	if err != nil {
+		return Estimation{}, err
+	}
+
+	return el[player], nil
+}
+
+// estimateAll returns an estimate for the expected utility of every player in
+// the given board state, using the same monte-carlo games for each. A target
+// width applies to the given player's interval, since the others' are only
+// along for the ride and may be much wider, such as when they're more likely
+// to drown.
+func estimateAll(s state.State, player int, opts EstimateOptions) (
+	[]Estimation, error) {
+
+	lastRound := opts.LastRound
+	if lastRound <= 0 {
+		lastRound = math.MaxInt32
+	}
+	utility := opts.Utility
+	if utility == nil {
+		utility = ExpectedScore{}
+	}
+
+	// If the game is already over, we can actually be exact.
+	el := make([]Estimation, len(s.Players()))
+	if s.Round() >= lastRound || s.Stage() == state.StageEndOfGame {
+		for i, u := range utility.Utilities(s) {
+			el[i].Mean = u
+			if opts.Samples {
+				el[i].Samples = []float64{u}
+			}
+		}
+
+		return el, nil
+	}
+
+	iterations := opts.Iterations
+	if iterations <= 0 {
+		iterations = estimateIterations
+	}
+	maxIterations := opts.MaxIterations
+	if maxIterations <= 0 {
+		maxIterations = estimateMaxIterations
+	}
+	seed := opts.Seed
+	if seed == 0 {
+		seed = newSeed()
+	}
+	policy := opts.Policy
+	if policy == nil {
+		policy = Uniform{}
+	}
+
+	sums := make([]float64, len(el))
+	squares := make([]float64, len(el))
+	var samples [][]float64
+	if opts.Samples {
+		samples = make([][]float64, len(el))
+	}
+	for n, batch := 0, iterations; batch > 0; {
+		ull, err := rollouts(s, lastRound, n, batch, opts.Workers, utility,
+			policy, seed)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ul := range ull {
+			for i, u := range ul {
+				sums[i] += u
+				squares[i] += u * u
+				if samples != nil {
+					samples[i] = append(samples[i], u)
+				}
+			}
+		}
+
+		n += batch
+		for i := range el {
+			el[i] = estimation(sums[i], squares[i], n)
+		}
+
+		if opts.Width <= 0 || el[player].width() <= opts.Width {
+			break
+		}
+
+		// Batches double the number of games played each time.
+		batch = n
+		if n+batch > maxIterations {
+			batch = maxIterations - n
+		}
+	}
+
+	for i := range samples {
+		sort.Float64s(samples[i])
+		el[i].Samples = samples[i]
+	}
+
+	return el, nil
+}
+
+// NewEstimation returns the estimation of an expected utility from the given
+// samples of it, such as the utilities of some random games. The samples are
+// kept in the estimation.
+func NewEstimation(samples []float64) Estimation {
+	var sum, squares float64
+	for _, u := range samples {
+		sum += u
+		squares += u * u
+	}
+
+	e := estimation(sum, squares, len(samples))
+	e.Samples = append([]float64(nil), samples...)
+	sort.Float64s(e.Samples)
+
+	return e
+}
+
+// estimation returns the estimation for a sample of n utilities with the
+// given sum and sum of squares.
+func estimation(sum, squares float64, n int) Estimation {
+	e := Estimation{Mean: sum / float64(n), N: n}
+	if n > 1 {
+		e.Variance = (squares - sum*e.Mean) / float64(n-1)
+		e.Variance = math.Max(0, e.Variance) // rounding errors
+		e.StdErr = math.Sqrt(e.Variance / float64(n))
+	}
+
+	return e
+}
+
+// width returns the width of the estimation's confidence interval.
+func (e Estimation) width() float64 {
+	return 2 * z95 * e.StdErr
+}
+
+func means(el []Estimation) []float64 {
+	res := make([]float64, len(el))
+	for i, e := range el {
+		res[i] = e.Mean
+	}
+
+	return res
+}
@@ -0,0 +1,163 @@
+package eval
+
+import (
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEstimateConvergence checks that estimates converge to the exact
+// expected utilities of random play in endgames small enough to enumerate.
+func TestEstimateConvergence(t *testing.T) {
+	s := endgame(t)
+	for i := 0; i < 2; i++ {
+		if i == 1 {
+			do(t, s, state.Roll(2)) // player 0 has a drop decision
+		}
+
+		exp := uniform(t, s, s.Round()+1)
+		for player := range s.Players() {
+			e, err := Estimate(s, player, EstimateOptions{
+				Iterations: 20000,
+				LastRound:  s.Round() + 1,
+				Seed:       int64(i + 1),
+			})
+			require.NoError(t, err)
+
+			assert.Equal(t, 20000, e.N)
+			assert.True(t, e.StdErr < 0.1)
+			assert.InDelta(t, exp[player], e.Mean, 4*e.StdErr,
+				"player %d", player)
+		}
+	}
+}
+
+func TestEstimateWidth(t *testing.T) {
+	s := state.NewStandardState(3)
+	opts := EstimateOptions{Iterations: 50, LastRound: 2, Width: 0.5, Seed: 1}
+
+	e, err := Estimate(s, 0, opts)
+	require.NoError(t, err)
+	assert.True(t, e.N > 50)
+	lo, hi := e.Interval()
+	assert.True(t, hi-lo <= 0.5)
+
+	// Sampling stops at the maximum number of games regardless.
+	opts.MaxIterations = 120
+	e, err = Estimate(s, 0, opts)
+	require.NoError(t, err)
+	assert.Equal(t, 120, e.N)
+}
+
+// TestEstimateWidthPlayer checks that sampling stops as soon as the requested
+// player's interval is narrow enough, regardless of the other players'.
+func TestEstimateWidthPlayer(t *testing.T) {
+	s := state.NewStandardState(3)
+	opts := EstimateOptions{Iterations: 50, LastRound: 2, Width: 1, Seed: 1}
+
+	ns := make(map[int]bool)
+	for player := range s.Players() {
+		e, err := Estimate(s, player, opts)
+		require.NoError(t, err)
+		lo, hi := e.Interval()
+		assert.True(t, hi-lo <= 1, "player %d", player)
+		ns[e.N] = true
+
+		if e.N == opts.Iterations {
+			continue
+		}
+
+		// Half as many games weren't enough.
+		half := opts
+		half.MaxIterations = e.N / 2
+		e, err = Estimate(s, player, half)
+		require.NoError(t, err)
+		lo, hi = e.Interval()
+		assert.True(t, hi-lo > 1, "player %d", player)
+	}
+
+	assert.True(t, len(ns) > 1)
+}
+
+func TestEstimateFinished(t *testing.T) {
+	s := endgame(t)
+	e, err := Estimate(s, 0, EstimateOptions{LastRound: s.Round()})
+	require.NoError(t, err)
+	assert.Equal(t, Estimation{Mean: rawUtility(s, 0)}, e)
+}
+
+func TestEstimation(t *testing.T) {
+	e := estimation(1+2+3+4, 1+4+9+16, 4)
+	assert.Equal(t, 2.5, e.Mean)
+	assert.InDelta(t, 5.0/3, e.Variance, 1e-9)
+	assert.InDelta(t, math.Sqrt(5.0/12), e.StdErr, 1e-9)
+}
+
+func TestEstimationDistribution(t *testing.T) {
+	e := NewEstimation([]float64{4, 1, 3, 2})
+	assert.Equal(t, []float64{1, 2, 3, 4}, e.Samples)
+	assert.Equal(t, 2.5, e.Mean)
+	assert.Equal(t, 1.0, e.Quantile(0))
+	assert.Equal(t, 2.5, e.Quantile(0.5))
+	assert.Equal(t, 4.0, e.Quantile(1))
+	assert.Equal(t, 0.5, e.ProbAtLeast(3))
+	assert.Equal(t, 0.0, e.ProbAtLeast(5))
+
+	// Without samples, utilities are assumed to be normally distributed.
+	e = Estimation{Mean: 1, Variance: 4}
+	assert.Equal(t, 2.0, e.StdDev())
+	assert.InDelta(t, 1, e.Quantile(0.5), 1e-9)
+	assert.InDelta(t, 1+2*1.96, e.Quantile(0.975), 1e-3)
+	assert.InDelta(t, 0.5, e.ProbAtLeast(1), 1e-9)
+	assert.InDelta(t, 0.025, e.ProbAtLeast(1+2*1.96), 1e-3)
+	assert.Equal(t, 1.0, Estimation{Mean: 1}.ProbAtLeast(1))
+	for _, q := range []float64{0, 0.5, 1} {
+		assert.Equal(t, 1.0, Estimation{Mean: 1}.Quantile(q))
+	}
+}
+
+func TestEstimateSamples(t *testing.T) {
+	s := state.NewStandardState(2)
+	e, err := Estimate(s, 0, EstimateOptions{
+		Iterations: 50,
+		LastRound:  2,
+		Samples:    true,
+		Seed:       1,
+	})
+	require.NoError(t, err)
+
+	require.Len(t, e.Samples, 50)
+	assert.True(t, sort.Float64sAreSorted(e.Samples))
+	assert.InDelta(t, NewEstimation(e.Samples).Mean, e.Mean, 1e-9)
+	assert.InDelta(t, NewEstimation(e.Samples).Variance, e.Variance, 1e-9)
+}
+
+// uniform computes the expected utilities of the given state by enumerating
+// every possible continuation of the current round, with decisions made
+// uniformly at random.
+func uniform(t *testing.T, s state.State, lastRound int) []float64 {
+	if s.Round() >= lastRound || s.Stage() == state.StageEndOfGame {
+		return rawUtilities(s)
+	}
+
+	exp := make([]float64, len(s.Players()))
+	vdl := s.ValidDecisions()
+	for _, vd := range vdl {
+		prob := 1 / float64(len(vdl))
+		if s.Stage() == state.StageRoll {
+			prob = rollProbability(vd)
+		}
+
+		require.NoError(t, s.Do(vd))
+		for i, u := range uniform(t, s, lastRound) {
+			exp[i] += prob * u
+		}
+		require.NoError(t, s.Undo())
+	}
+
+	return exp
+}
@@ -3,166 +3,571 @@
 package eval
 
 import (
-	"math/big"
-	"math/rand"
+	"context"
+	"errors"
+	"fmt"
+	"math"
 
 	"github.com/bubblyworld/deep-sea-adventure/state"
 )
 
-// Number of random monte-carlo games to consider for utility estimation.
-const estimateIterations = 100
+// Mode is an assumption about how opponents make their decisions, which
+// determines the kind of search performed by Evaluate.
+type Mode int
+
+const (
+	// ModeParanoid assumes that all opponents are working in tandem to
+	// undermine the evaluating player, which minimises exploitability.
+	ModeParanoid Mode = iota
+
+	// ModeMaxN assumes that every player maximises their own utility.
+	ModeMaxN
+
+	// ModeBestReply is best-reply search, in which the opponents' turns
+	// between two of the player's turns are folded into a single layer.
+	// Only one opponent replies to the player, which is whichever one can
+	// do the most damage. Players can't skip turns, so the others make the
+	// decisions a Cautious player would, which is the BRS+ variant of the
+	// search.
+	ModeBestReply
+)
+
+// Options configures the search performed by Evaluate.
+type Options struct {
+	// Depth is the number of decisions to search before falling back to
+	// monte-carlo estimation of utilities.
+	Depth int
+
+	// Mode is the assumed behaviour of opponents, paranoid by default.
+	Mode Mode
+
+	// Opponents, if non-nil, models the decisions of opponents by seat.
+	// Modelled opponents make decisions with their policy instead of as the
+	// search mode assumes. Stochastic policies are taken into account
+	// exactly, and other policies are assumed to be deterministic. Nil
+	// entries and the evaluating player's own seat aren't modelled.
+	// Strategies can be used as models with game.NewPolicy.
+	Opponents []Policy
+
+	// DisablePruning turns off alpha/beta pruning of paranoid searches,
+	// which is useful for measuring how much work pruning saves. Other
+	// search modes are never pruned.
+	DisablePruning bool
+
+	// Workers is the number of goroutines to split the search between. The
+	// valid decisions are divided between workers, and any workers left
+	// over are used for monte-carlo estimation. By default there's one.
+	Workers int
+
+	// Seed, if non-zero, seeds the random number generation used by the
+	// search, so that results are deterministic regardless of the number of
+	// workers. A Table shared by concurrent workers can still make results
+	// depend on their timing.
+	Seed int64
+
+	// Utility is what the search maximises the expectation of, by default
+	// the expected score of each player.
+	Utility Utility
+
+	// Horizon is the number of rounds to search, by default just the
+	// current one.
+	Horizon Horizon
+
+	// Bonus, if positive, is the weight of a bonus for the value of the
+	// treasure left on the board at the horizon, which is split evenly
+	// between players as an estimate of their share of it in future
+	// rounds. Only the built-in utilities support a bonus.
+	Bonus float64
+
+	// Risk, if non-nil, ranks the player's decisions by the distribution
+	// of their utility rather than just its expectation, as described by
+	// EvaluateDistributions. Searches with iterative deepening don't
+	// support it.
+	Risk Risk
+
+	// Leaf evaluates states at which the search stops before the end of
+	// the round, using Rollouts by default.
+	Leaf LeafEvaluator
+
+	// DisableSolver turns off exact solving of single-diver leaves (see
+	// Solve), which are otherwise solved in place of the leaf evaluator if
+	// the horizon is the end of their round, they're small enough, and the
+	// diver maximises their own utility rather than being an adversary.
+	DisableSolver bool
+
+	// Tablebase, if non-nil, is probed for the exact values of positions
+	// in max-n searches of ExpectedScore to the end of the round, which
+	// are the searches its values are valid for.
+	Tablebase *Tablebase
+
+	// Table, if non-nil, is used to cache the values of states visited by
+	// the search. It can be shared between searches.
+	Table *Table
+
+	// Stats, if non-nil, is incremented with counts of the work done.
+	Stats *Stats
+}
+
+// Stats counts the work done by a search.
+type Stats struct {
+	Nodes   int // states visited by the search, including leaves
+	Leaves  int // states evaluated by monte-carlo estimation
+	Cutoffs int // times the remaining decisions of a state were pruned
+	Hits    int // states whose value was found in the transposition table
+	Misses  int // states whose value wasn't found in the transposition table
+	Solves  int // leaves that were solved exactly
+	Probes  int // states whose value was found in the tablebase
+}
+
+func (st *Stats) add(o *Stats) {
+	st.Nodes += o.Nodes
+	st.Leaves += o.Leaves
+	st.Cutoffs += o.Cutoffs
+	st.Hits += o.Hits
+	st.Misses += o.Misses
+	st.Solves += o.Solves
+	st.Probes += o.Probes
+}
+
+// since returns the work done since the stats were the given ones.
+func (st *Stats) since(o Stats) *Stats {
+	return &Stats{
+		Nodes:   st.Nodes - o.Nodes,
+		Leaves:  st.Leaves - o.Leaves,
+		Cutoffs: st.Cutoffs - o.Cutoffs,
+		Hits:    st.Hits - o.Hits,
+		Misses:  st.Misses - o.Misses,
+		Solves:  st.Solves - o.Solves,
+		Probes:  st.Probes - o.Probes,
+	}
+}
 
 // Evaluate returns a map of valid decisions to their approximate expected
-// utility for the current player. To minimise exploitability we assume that
-// other players are working in tandem to undermine the given player, and only
+// utility for the current player. Rolls are chance nodes, and are weighted by
+// the probability of rolling them with the special dice. The behaviour of
+// opponents is determined by the options' search mode. By default we only
 // compute till the end of the current round to avoid evaluation drifts over
-// longer-term computation.
-// TODO: This assumption may be too strict - we should probably assume each
-//       player has their interests at heart.
-func Evaluate(s state.State, depth int) (
+// longer-term computation, but the horizon can be extended with the options.
+// If the options have a risk criterion, decisions are valued by it instead.
+func Evaluate(s state.State, opts Options) (
 	map[state.Decision]float64, error) {
 
-	return evaluate(s, s.CurrentPlayer(), depth, s.Round()+1)
+	if opts.Risk != nil {
+		return evaluateRisk(s, opts)
+	}
+	if opts.Depth <= 0 {
+		return nil, nil // we're done, at max depth
+	}
+
+	sr, err := newSearcher(context.Background(), s, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return sr.search(s, opts, opts.Depth)
 }
 
-func evaluate(s state.State, player, depth, lastRound int) (
-	map[state.Decision]float64, error) {
+// EvaluateContext is like Evaluate, but searches with iterative deepening
+// until the context is done, returning the results of the deepest search that
+// completed along with its depth. The options' depth is the maximum depth to
+// search to, or unlimited if it isn't positive. Searching stops early once a
+// depth is reached at which every line ends with the round, since deeper
+// searches would give the same results. Stats are accumulated over every
+// iteration of the search.
+//
+// An error is returned if the context is done before the first iteration has
+// completed. The state is restored in either case.
+func EvaluateContext(ctx context.Context, s state.State, opts Options) (
+	map[state.Decision]float64, int, error) {
+
+	sr, err := newSearcher(ctx, s, opts)
+	if err != nil {
+		return nil, 0, err
+	}
 
-	if depth <= 0 || s.Round() >= lastRound {
-		return nil, nil // we're done, at max depth
+	var best map[state.Decision]float64
+	var bestDepth int
+	err = sr.deepen(s, opts, func(dm map[state.Decision]float64, depth int) {
+		best, bestDepth = dm, depth
+	})
+	if err != nil {
+		return nil, 0, err
 	}
 
-	vdl := s.ValidDecisions()
-	if len(vdl) == 0 {
-		return nil, nil // the game is over
+	return best, bestDepth, nil
+}
+
+// deepen searches with iterative deepening as described by EvaluateContext,
+// calling the given function with the results of each iteration that
+// completes. An error is returned if none of them complete.
+func (sr *searcher) deepen(s state.State, opts Options,
+	done func(dm map[state.Decision]float64, depth int)) error {
+
+	if opts.Risk != nil {
+		return errors.New("risk-sensitive searches can't be deepened")
 	}
 
-	dm := make(map[state.Decision]float64)
-	for _, vd := range vdl {
-		if err := s.Do(vd); err != nil {
-			return nil, err
+	var completed bool
+	for depth := 1; opts.Depth <= 0 || depth <= opts.Depth; depth++ {
+		sr.truncated = false
+		for _, r := range sr.roots {
+			r.truncated = false
 		}
 
-		cdm, err := evaluate(s, player, depth-1, lastRound)
+		dm, err := sr.search(s, opts, depth)
 		if err != nil {
-			return nil, err
-		}
-
-		// If we get nil from the child, it means we've either reached the
-		// end of the game or we've bottomed out depth-wise. In this case we
-		// need to pass to the cheaper monte-carlo estimation to avoid the
-		// crazy combinatorial explosion of states.
-		var best float64
-		if len(cdm) == 0 {
-			e, err := Estimate(s, player, estimateIterations, lastRound)
-			if err != nil {
-				return nil, err
+			if completed && err == sr.ctx.Err() {
+				break
 			}
 
-			best = e
-		} else {
-			cp := s.CurrentPlayer()
-			best = float64(-999999) // "negative infinity" X_X
-			if cp != player {
-				best = float64(999999) // "positive infinity" 0_D
-			}
+			return err
+		}
 
-			for _, eval := range cdm {
-				// Try to maximise the score if we're the given player, else
-				// we try and screw them over as hard as possible.
-				if cp == player {
-					if eval > best {
-						best = eval
-					}
-				} else {
-					if eval < best {
-						best = eval
-					}
-				}
-			}
+		completed = true
+		done(dm, depth)
+		if !sr.truncated {
+			break
 		}
+	}
 
-		dm[vd] = best
-		if err := s.Undo(); err != nil {
+	return nil
+}
+
+func newSearcher(ctx context.Context, s state.State, opts Options) (
+	*searcher, error) {
+
+	stats := opts.Stats
+	if stats == nil {
+		stats = new(Stats)
+	}
+
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	leafEval := opts.Leaf
+	if leafEval == nil {
+		leafEval = Rollouts{}
+	}
+	utility := opts.Utility
+	if utility == nil {
+		utility = ExpectedScore{}
+	}
+	if opts.Bonus > 0 {
+		var err error
+		if utility, err = newBonus(utility, opts.Bonus); err != nil {
 			return nil, err
 		}
 	}
 
-	return dm, nil
+	solveStates := leafSolveStates
+	if opts.DisableSolver {
+		solveStates = 0
+	}
+
+	opps := opponents(opts.Opponents, s.CurrentPlayer())
+	params := searchParams(utility, opps, leafEval, solveStates,
+		opts.Tablebase)
+
+	return &searcher{
+		player:      s.CurrentPlayer(),
+		opponents:   opps,
+		adversary:   adversaryAll,
+		lastRound:   opts.Horizon.lastRound(s),
+		workers:     workers,
+		leafWorkers: 1,
+		seed:        opts.Seed,
+		solveStates: solveStates,
+		utility:     utility,
+		leafEval:    leafEval,
+		stats:       stats,
+		table:       opts.Table,
+		tablebase:   opts.Tablebase,
+		params:      params,
+		ctx:         ctx,
+	}, nil
 }
 
-// Estimate returns an estimate for the expected utility for the given player
-// in the given board state. Calculations are performed using weighted monte-
-// -carlo tree searches to possible end states.
-func Estimate(s state.State, player, iterations, lastRound int) (
-	float64, error) {
+// search returns a map of the valid decisions in the given state to their
+// value for the player, using the options' search mode to the given depth.
+func (sr *searcher) search(s state.State, opts Options, depth int) (
+	map[state.Decision]float64, error) {
+
+	switch opts.Mode {
+	case ModeParanoid:
+		sr.adversary = adversaryAll
+		if opts.DisablePruning {
+			return sr.evaluate(s, depth)
+		}
+
+		return sr.evaluatePruned(s, depth)
+
+	case ModeMaxN:
+		sr.adversary = adversaryNone
+		return sr.evaluate(s, depth)
 
-	// If the game is already over, we can actually be exact.
-	if s.Round() >= lastRound || s.Stage() == state.StageEndOfGame {
-		return rawUtility(s, player), nil
+	case ModeBestReply:
+		// The replying opponent is chosen when their turns come around.
+		sr.adversary = adversaryNone
+		sr.bestReply = true
+		return sr.evaluate(s, depth)
 	}
 
-	var ul []float64
-	var pl []*big.Rat
-	psum := new(big.Rat)
-	for i := 0; i < iterations; i++ {
-		util, prob, err := montecarlo(s, player)
+	return nil, fmt.Errorf("unknown search mode %d", opts.Mode)
+}
+
+const (
+	adversaryNone = -1 // every player maximises their own utility
+	adversaryAll  = -2 // every opponent minimises the player's utility
+)
+
+// searcher holds the parameters of a single search through the game tree.
+// Values of states are vectors of expected utilities indexed by player.
+type searcher struct {
+	player      int      // player we are evaluating decisions for
+	adversary   int      // opponent undermining the player, if any
+	bestReply   bool     // whether opponents' turns are best replies
+	opponents   []Policy // models of opponents by seat, if any
+	lastRound   int      // round at which the search is cut off
+	workers     int      // goroutines to split the valid decisions between
+	leafWorkers int      // goroutines to split monte-carlo estimation between
+	seed        int64    // seed for leaf estimation, or zero for a random one
+	maxNodes    int      // nodes to search before giving up, if positive
+	solveStates int      // states to solve single-diver leaves with, if positive
+	utility     Utility
+	risk        Risk // player's risk criterion, for risk-sensitive searches
+	leafEval    LeafEvaluator
+	stats       *Stats
+	table       *Table
+	tablebase   *Tablebase
+	params      uint64 // hash of the parameters above, for table keys
+	ctx         context.Context
+
+	// truncated is set if a leaf is reached because the search ran out of
+	// depth rather than at the end of the round.
+	truncated bool
+
+	// roots, if non-nil, records the work done below each root decision.
+	roots map[state.Decision]*root
+}
+
+// evaluate returns a map of the valid decisions in the given state to the
+// player's value of the state that results from making them.
+func (sr *searcher) evaluate(s state.State, depth int) (
+	map[state.Decision]float64, error) {
+
+	return sr.rootValues(s, func(sr *searcher, s state.State) (float64, error) {
+		v, err := sr.value(s, depth-1)
 		if err != nil {
 			return 0, err
 		}
 
-		ul = append(ul, util)
-		pl = append(pl, prob)
-		psum.Add(psum, prob)
+		return v[sr.player], nil
+	})
+}
+
+// children returns the valid decisions in the given state, along with the
+// value of the state that results from making each of them.
+func (sr *searcher) children(s state.State, depth int) (
+	[]state.Decision, [][]float64, error) {
+
+	vdl := s.ValidDecisions()
+	vl := make([][]float64, len(vdl))
+	for i, vd := range vdl {
+		if err := s.Do(vd); err != nil {
+			return nil, nil, err
+		}
+
+		v, err := sr.value(s, depth-1)
+		if err := s.Undo(); err != nil {
+			return nil, nil, err
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		vl[i] = v
+	}
+
+	return vdl, vl, nil
+}
+
+// value returns the expected utility of the given state for each player.
+func (sr *searcher) value(s state.State, depth int) ([]float64, error) {
+	if err := sr.check(); err != nil {
+		return nil, err
+	}
+
+	sr.stats.Nodes++
+	return sr.cached(s, depth, false, math.Inf(-1), math.Inf(1),
+		func() ([]float64, error) { return sr.computeValue(s, depth) })
+}
+
+// computeValue is value without the transposition table.
+func (sr *searcher) computeValue(s state.State, depth int) ([]float64, error) {
+	if v, ok := sr.probeTablebase(s); ok {
+		return v, nil
+	}
+	if sr.isLeaf(s, depth) {
+		return sr.leaf(s, depth)
+	}
+	if sr.bestReply {
+		if v, ok, err := sr.reply(s, depth); ok || err != nil {
+			return v, err
+		}
+	}
+
+	// Modelled opponents make decisions according to their models.
+	if sr.modelled(s) {
+		return sr.expectation(s, func() ([]float64, error) {
+			return sr.value(s, depth-1)
+		})
 	}
 
-	var usum float64
-	for i := 0; i < iterations; i++ {
-		prob := new(big.Rat)
-		prob.Quo(pl[i], psum)
-		probf, _ := prob.Float64()
+	vdl, vl, err := sr.children(s, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rolls are chance nodes, so their value is the expected value over all
+	// of the possible rolls of the dice.
+	if s.Stage() == state.StageRoll {
+		exp := make([]float64, len(s.Players()))
+		for i, vd := range vdl {
+			for j := range exp {
+				exp[j] += rollProbability(vd) * vl[i][j]
+			}
+		}
+
+		return exp, nil
+	}
 
-		usum += probf * ul[i]
+	// Otherwise the current player picks the decision that's best for them,
+	// which for adversaries means screwing the player over as hard as they
+	// possibly can.
+	cp := s.CurrentPlayer()
+	adversarial := cp != sr.player &&
+		(sr.adversary == adversaryAll || sr.adversary == cp)
+
+	best := vl[0]
+	for _, v := range vl[1:] {
+		if adversarial {
+			if v[sr.player] < best[sr.player] {
+				best = v
+			}
+		} else {
+			if v[cp] > best[cp] {
+				best = v
+			}
+		}
 	}
 
-	return usum, nil
+	return best, nil
 }
 
-var diceProbability = map[int]*big.Rat{
-	2: big.NewRat(1, 9),
-	3: big.NewRat(2, 9),
-	4: big.NewRat(3, 9),
-	5: big.NewRat(2, 9),
-	6: big.NewRat(1, 9),
+// isLeaf returns true if the search should stop at the given state. If we've
+// either reached the end of the game or we've bottomed out depth-wise, we
+// need to pass to the cheaper monte-carlo estimation to avoid the crazy
+// combinatorial explosion of states.
+func (sr *searcher) isLeaf(s state.State, depth int) bool {
+	return depth <= 0 || s.Round() >= sr.lastRound ||
+		s.Stage() == state.StageEndOfGame
 }
 
-func montecarlo(s state.State, player int) (float64, *big.Rat, error) {
-	if s.Stage() == state.StageEndOfGame { // end of game
-		return rawUtility(s, player), big.NewRat(1, 1), nil
+// probeTablebase returns the value of the given state from the tablebase, if
+// there is one and it has the state.
+func (sr *searcher) probeTablebase(s state.State) ([]float64, bool) {
+	if sr.tablebase == nil || sr.adversary != adversaryNone || sr.bestReply ||
+		sr.opponents != nil || s.Round()+1 != sr.lastRound {
+		return nil, false
+	}
+	if _, ok := sr.utility.(ExpectedScore); !ok {
+		return nil, false
 	}
 
-	vdl := s.ValidDecisions()
-	vd := vdl[rand.Intn(len(vdl))]
-	prob := big.NewRat(1, int64(len(vdl)))
-	if s.Stage() == state.StageRoll { // the only chance nodes are rolls
-		prob = diceProbability[int(vd.Value())]
+	v, ok := sr.tablebase.Probe(s)
+	if ok {
+		sr.stats.Probes++
 	}
 
-	if err := s.Do(vd); err != nil {
-		return 0, nil, err
+	return v, ok
+}
+
+// check returns an error if the search should be abandoned.
+func (sr *searcher) check() error {
+	if sr.maxNodes > 0 && sr.stats.Nodes >= sr.maxNodes {
+		return errNodeLimit
 	}
 
-	util, childProb, err := montecarlo(s, player)
-	if err != nil {
-		return 0, nil, err
+	return sr.ctx.Err()
+}
+
+// leaf returns the utilities of a state at which the search stops, which are
+// exact at the end of the round or for small single-diver positions, and
+// estimated by the leaf evaluator otherwise.
+func (sr *searcher) leaf(s state.State, depth int) ([]float64, error) {
+	sr.stats.Leaves++
+	if s.Round() >= sr.lastRound || s.Stage() == state.StageEndOfGame {
+		return sr.utility.Utilities(s), nil
+	}
+
+	// The solver assumes the diver maximises their own utility, which isn't
+	// the case for adversaries, modelled opponents, or opponents of
+	// best-reply searches.
+	if diver, ok := Solvable(s); ok && sr.solveStates > 0 &&
+		s.Round()+1 == sr.lastRound && sr.model(diver) == nil &&
+		(diver == sr.player || sr.adversary == adversaryNone &&
+			!sr.bestReply) {
+
+		sol, err := Solve(s, SolveOptions{
+			Utility:   sr.utility,
+			MaxStates: sr.solveStates,
+		})
+		if err == nil {
+			sr.stats.Solves++
+			return sol.Values, nil
+		}
+		if err != errStateLimit {
+			return nil, err
+		}
 	}
+	sr.truncated = true
 
-	if err := s.Undo(); err != nil {
-		return 0, nil, err
+	return sr.leafEval.Evaluate(sr.leafOf(s))
+}
+
+// leafOf returns the given state as a leaf of the search.
+func (sr *searcher) leafOf(s state.State) Leaf {
+	// Seeded searches derive the seed of each leaf from its position, so
+	// that leaves are estimated the same way however they're reached.
+	seed := sr.seed
+	if seed != 0 {
+		seed ^= int64(state.Hash(s, 0))
 	}
 
-	rp := new(big.Rat)
-	return util, rp.Mul(prob, childProb), nil
+	return Leaf{
+		State:     s,
+		Player:    sr.player,
+		LastRound: sr.lastRound,
+		Utility:   sr.utility,
+		Opponents: sr.opponents,
+		Workers:   sr.leafWorkers,
+		Seed:      seed,
+	}
+}
+
+var diceProbability = map[int]float64{
+	2: 1.0 / 9,
+	3: 2.0 / 9,
+	4: 3.0 / 9,
+	5: 2.0 / 9,
+	6: 1.0 / 9,
+}
+
+// rollProbability returns the probability of rolling the given decision.
+func rollProbability(d state.Decision) float64 {
+	return diceProbability[int(d.Value())]
 }
 
 var expectedUtility = map[state.TreasureType]float64{
@@ -176,6 +581,15 @@ func rawUtility(s state.State, player int) float64 {
 	return sum(s.Players()[player].StashedTreasure)
 }
 
+func rawUtilities(s state.State) []float64 {
+	ul := make([]float64, len(s.Players()))
+	for i := range ul {
+		ul[i] = rawUtility(s, i)
+	}
+
+	return ul
+}
+
 func sum(tsl []state.TreasureStack) float64 {
 	var sum float64
 	for _, ts := range tsl {
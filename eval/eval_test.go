@@ -1,7 +1,10 @@
 package eval
 
 import (
+	"context"
+	"math/rand"
 	"testing"
+	"time"
 
 	"github.com/bubblyworld/deep-sea-adventure/state"
 	"github.com/stretchr/testify/assert"
@@ -16,9 +19,10 @@ func TestMonteCarlo(t *testing.T) {
 
 	var max float64
 	for i := 0; i < 100; i++ {
-		util, prob, err := montecarlo(s, 1)
+		rng := rand.New(rand.NewSource(int64(i)))
+		ul, err := playout(s, 10, ExpectedScore{}, Uniform{}, rng)
 		require.NoError(t, err)
-		assert.True(t, prob.Sign() > 0)
+		util := ul[1]
 
 		if util > max {
 			max = util
@@ -34,8 +38,212 @@ func TestEstimate(t *testing.T) {
 	s := state.NewStandardState(6)
 
 	for i := 0; i < 100; i++ {
-		util, err := Estimate(s, 1, 100, 10)
+		util, err := Estimate(s, 1, EstimateOptions{Iterations: 100, LastRound: 10})
 		require.NoError(t, err)
-		assert.True(t, util > 0)
+		assert.True(t, util.Mean > 0)
+	}
+}
+
+// TestEvaluateExpectation checks that rolls are weighted by their probability
+// in a position small enough to compute by hand. The player has a single
+// chip and is heading home. Any roll but a 2 gets them home immediately, but
+// a 2 lands them on another chip which they can take home with them too.
+func TestEvaluateExpectation(t *testing.T) {
+	s := state.NewStandardState(1)
+	do(t, s, state.Roll(2), state.PickUp(true), state.Turn(true))
+
+	dm, err := Evaluate(s, Options{Depth: 30})
+	require.NoError(t, err)
+	require.Len(t, dm, 5)
+	for r := 3; r <= 6; r++ {
+		assert.Equal(t, 1.5, dm[state.Roll(r)])
+	}
+	assert.InDelta(t, 3.0, dm[state.Roll(2)], 1e-6)
+
+	var exp float64
+	for d, v := range dm {
+		exp += rollProbability(d) * v
+	}
+	assert.InDelta(t, 8.0/9*1.5+1.0/9*3.0, exp, 1e-6)
+}
+
+// TestEvaluateBruteForce compares Evaluate against a brute-force enumeration
+// of a small endgame, which is searched all the way to the end of the round.
+func TestEvaluateBruteForce(t *testing.T) {
+	s := endgame(t)
+	for _, adversary := range []int{adversaryAll, adversaryNone} {
+		for player := 0; player < 2; player++ {
+			sr := searcher{
+				player:    player,
+				adversary: adversary,
+				lastRound: s.Round() + 1,
+				utility:   ExpectedScore{},
+				leafEval:  Rollouts{},
+				stats:     new(Stats),
+				ctx:       context.Background(),
+			}
+
+			dm, err := sr.evaluate(s, 100)
+			require.NoError(t, err)
+
+			for _, vd := range s.ValidDecisions() {
+				require.NoError(t, s.Do(vd))
+				exp := bruteForce(t, s, player, adversary, s.Round())
+				require.NoError(t, s.Undo())
+
+				assert.InDelta(t, exp[player], dm[vd], 1e-9, "decision %s", vd)
+			}
+		}
+	}
+}
+
+// TestEvaluateModes checks the relationships between search modes. With two
+// players, best-reply search is the same as paranoid search, and nobody can
+// do worse than they would against paranoid opponents.
+func TestEvaluateModes(t *testing.T) {
+	s := endgame(t)
+	require.NoError(t, s.Do(state.Roll(2))) // player 0 has a drop decision
+
+	paranoid, err := Evaluate(s, Options{Depth: 100})
+	require.NoError(t, err)
+	maxn, err := Evaluate(s, Options{Depth: 100, Mode: ModeMaxN})
+	require.NoError(t, err)
+	reply, err := Evaluate(s, Options{Depth: 100, Mode: ModeBestReply})
+	require.NoError(t, err)
+
+	require.Len(t, paranoid, 3)
+	for d, eval := range paranoid {
+		assert.InDelta(t, eval, reply[d], 1e-9)
+		assert.True(t, eval <= maxn[d]+1e-9)
+	}
+
+	_, err = Evaluate(s, Options{Depth: 1, Mode: Mode(-1)})
+	assert.Error(t, err)
+}
+
+// TestEvaluateContext checks that iterative deepening stops once the whole
+// round has been searched, with the same results as a fixed-depth search.
+func TestEvaluateContext(t *testing.T) {
+	s := endgame(t)
+	require.NoError(t, s.Do(state.Roll(2))) // player 0 has a drop decision
+
+	for _, mode := range []Mode{ModeParanoid, ModeMaxN} {
+		exp, err := Evaluate(s, Options{Depth: 100, Mode: mode})
+		require.NoError(t, err)
+
+		dm, depth, err := EvaluateContext(context.Background(), s,
+			Options{Mode: mode})
+		require.NoError(t, err)
+		assert.True(t, depth > 1 && depth < 100, "depth %d", depth)
+
+		require.Len(t, dm, len(exp))
+		for d, eval := range exp {
+			assert.InDelta(t, eval, dm[d], 1e-9, "decision %s", d)
+		}
+	}
+
+	// The maximum depth is respected.
+	_, depth, err := EvaluateContext(context.Background(), s, Options{Depth: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 1, depth)
+}
+
+func TestEvaluateContextCancel(t *testing.T) {
+	s := state.NewStandardState(4)
+	key := state.Canonical(s, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := EvaluateContext(ctx, s, Options{})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, key, state.Canonical(s, 0))
+
+	// A search of the opening can't complete in time, so we should get back
+	// a shallower iteration promptly.
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	dm, depth, err := EvaluateContext(ctx, s, Options{})
+	require.NoError(t, err)
+	assert.True(t, time.Since(start) < 2*time.Second)
+	assert.True(t, depth >= 1)
+	assert.Len(t, dm, 5)
+	assert.Equal(t, key, state.Canonical(s, 0))
+}
+
+var rollProbabilities = map[state.Decision]float64{
+	state.Roll(2): 1.0 / 9,
+	state.Roll(3): 2.0 / 9,
+	state.Roll(4): 3.0 / 9,
+	state.Roll(5): 2.0 / 9,
+	state.Roll(6): 1.0 / 9,
+}
+
+// bruteForce computes the utilities of the given state by enumerating every
+// possible continuation of the current round. Players maximise their own
+// utility, except for adversaries who minimise the given player's utility.
+func bruteForce(t *testing.T, s state.State, player, adversary, round int) []float64 {
+	return bruteForceUtility(t, s, ExpectedScore{}, player, adversary, round)
+}
+
+// bruteForceUtility is bruteForce for the given utility.
+func bruteForceUtility(t *testing.T, s state.State, u Utility, player,
+	adversary, round int) []float64 {
+
+	if s.Round() > round || s.Stage() == state.StageEndOfGame {
+		return u.Utilities(s)
+	}
+
+	cp := s.CurrentPlayer()
+	adversarial := cp != player && (adversary == adversaryAll || adversary == cp)
+
+	var best []float64
+	exp := make([]float64, len(s.Players()))
+	for _, vd := range s.ValidDecisions() {
+		require.NoError(t, s.Do(vd))
+		v := bruteForceUtility(t, s, u, player, adversary, round)
+		require.NoError(t, s.Undo())
+
+		for i := range exp {
+			exp[i] += rollProbabilities[vd] * v[i]
+		}
+
+		switch {
+		case best == nil:
+			best = v
+		case adversarial && v[player] < best[player]:
+			best = v
+		case !adversarial && v[cp] > best[cp]:
+			best = v
+		}
+	}
+
+	if s.Stage() == state.StageRoll {
+		return exp
+	}
+
+	return best
+}
+
+// endgame returns a two player state near the end of the first round. Both
+// players have turned around with treasure and are close to the submarine.
+func endgame(t *testing.T) state.State {
+	s := state.NewStandardState(2)
+	do(t, s,
+		state.Roll(2), state.PickUp(true), // player 0 to tile 2
+		state.Roll(2), state.PickUp(true), // player 1 hops to tile 3
+		state.Turn(true), state.Roll(2), state.PickUp(true), // player 0 to 1
+		state.Turn(true), state.Roll(2), state.Drop(0, false), // player 1 to 2
+	)
+
+	return s
+}
+
+func do(t *testing.T, s state.State, dl ...state.Decision) {
+	t.Helper()
+
+	for _, d := range dl {
+		require.NoError(t, s.Do(d), "doing %s", d)
 	}
 }
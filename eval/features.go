@@ -0,0 +1,278 @@
+package eval
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+)
+
+// Feature is a named measurement of a player's position, which is the basis
+// of the Featured leaf evaluator. Treasure is valued by its expected value.
+type Feature struct {
+	Name        string
+	Description string
+
+	value func(s state.State, player int) float64
+}
+
+// Value returns the feature's value for the given player in the given state.
+func (f Feature) Value(s state.State, player int) float64 {
+	return f.value(s, player)
+}
+
+// Features are the features of positions, in the order that FeatureValues
+// returns them.
+var Features = []Feature{
+	{
+		Name:        "stashed",
+		Description: "value of the player's stashed treasure",
+		value: func(s state.State, player int) float64 {
+			stashed, _, _ := projection(s, player, 0, ExpectedScore{})
+			return stashed
+		},
+	},
+	{
+		Name:        "held",
+		Description: "value of the player's held treasure",
+		value: func(s state.State, player int) float64 {
+			_, held, _ := projection(s, player, 0, ExpectedScore{})
+			return held
+		},
+	},
+	{
+		Name: "held_at_risk",
+		Description: "value of the player's held treasure, weighted by the " +
+			"odds of it being lost at sea",
+		value: func(s state.State, player int) float64 {
+			_, _, lost := projection(s, player, airCycles(s), ExpectedScore{})
+			return lost
+		},
+	},
+	{
+		Name: "return_turns",
+		Description: "turns the player needs to get back to the submarine " +
+			"given how much they're holding, or zero if they're back",
+		value: func(s state.State, player int) float64 {
+			p := s.Players()[player]
+			if p.Done() {
+				return 0
+			}
+
+			return returnDistance(p) / diverSpeed(p)
+		},
+	},
+	{
+		Name: "air_turns",
+		Description: "turns everybody can take before the air runs out, " +
+			"given the stacks held at sea",
+		value: func(s state.State, player int) float64 {
+			return airCycles(s)
+		},
+	},
+	{
+		Name: "air_margin",
+		Description: "turns to spare between the air running out and the " +
+			"player getting back, or zero if they're back",
+		value: func(s state.State, player int) float64 {
+			p := s.Players()[player]
+			if p.Done() {
+				return 0
+			}
+
+			return airCycles(s) - returnDistance(p)/diverSpeed(p)
+		},
+	},
+	{
+		Name:        "opponents_held",
+		Description: "stacks of treasure held by the player's opponents",
+		value: func(s state.State, player int) float64 {
+			var stacks int
+			for i, p := range s.Players() {
+				if i != player {
+					stacks += len(p.HeldTreasure)
+				}
+			}
+
+			return float64(stacks)
+		},
+	},
+	{
+		Name: "ahead",
+		Description: "value of the treasure on the tiles the player is " +
+			"heading towards",
+		value: func(s state.State, player int) float64 {
+			p := s.Players()[player]
+			if p.Done() {
+				return 0
+			}
+
+			lo, hi := p.Position+1, len(s.Tiles())
+			if p.TurnedAround {
+				lo, hi = 1, p.Position
+			}
+
+			var tsl []state.TreasureStack
+			for _, t := range s.Tiles()[lo:hi] {
+				if t.Treasure != nil {
+					tsl = append(tsl, *t.Treasure)
+				}
+			}
+
+			return sum(tsl)
+		},
+	},
+	{
+		Name:        "done",
+		Description: "whether the player is back in the submarine",
+		value: func(s state.State, player int) float64 {
+			if s.Players()[player].Done() {
+				return 1
+			}
+
+			return 0
+		},
+	},
+}
+
+// FeatureValues returns the value of every feature for the given player in
+// the given state, in the order of Features.
+func FeatureValues(s state.State, player int) []float64 {
+	res := make([]float64, len(Features))
+	for i, f := range Features {
+		res[i] = f.Value(s, player)
+	}
+
+	return res
+}
+
+// Weights are the weights of features by name. Features that aren't weighted
+// have a weight of zero.
+type Weights map[string]float64
+
+// DefaultWeights returns the weights that make Featured agree with Heuristic
+// for ExpectedScore, which are a reasonable starting point for tuning.
+func DefaultWeights() Weights {
+	return Weights{
+		"stashed":      1,
+		"held":         1,
+		"held_at_risk": -1,
+	}
+}
+
+// defaultWeights are the weights of Featured evaluators without any, which
+// are shared so that evaluating leaves doesn't allocate them.
+var defaultWeights = DefaultWeights()
+
+// LoadWeights reads weights from the given JSON file, which must be an object
+// mapping feature names to their weights.
+func LoadWeights(path string) (Weights, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var w Weights
+	if err := json.NewDecoder(f).Decode(&w); err != nil {
+		return nil, fmt.Errorf("error parsing weights: %v", err)
+	}
+	if err := w.Validate(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Save writes the weights to the given file in the format read by
+// LoadWeights.
+func (w Weights) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(w); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Validate returns an error if the weights aren't all finite weights of
+// known features.
+func (w Weights) Validate() error {
+	for name, weight := range w {
+		if featureIndex(name) < 0 {
+			return fmt.Errorf("unknown feature %q", name)
+		}
+		if math.IsNaN(weight) || math.IsInf(weight, 0) {
+			return fmt.Errorf("invalid weight %v for feature %q", weight, name)
+		}
+	}
+
+	return nil
+}
+
+// featureIndex returns the index of the named feature, or -1 if there isn't
+// one.
+func featureIndex(name string) int {
+	for i, f := range Features {
+		if f.Name == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Featured estimates leaves with a weighted sum of features, which projects
+// each player's expected score. Like Heuristic it doesn't search, and only
+// the built-in utilities are supported, which are applied to the projected
+// scores. Projected scores are clamped to the scores players can actually end
+// up with, since pruned searches rely on leaves respecting the bounds of the
+// utility.
+type Featured struct {
+	// Weights are the weights of the features, or DefaultWeights if nil.
+	// They aren't validated while evaluating leaves, so they should come
+	// from LoadWeights or be checked with Validate first.
+	Weights Weights
+
+	// Bias is added to every player's projected score.
+	Bias float64
+}
+
+func (f Featured) Evaluate(l Leaf) ([]float64, error) {
+	u, ok := l.utility().(scoreUtility)
+	if !ok {
+		return nil, errors.New(
+			"featured evaluation only supports built-in utilities")
+	}
+
+	w := f.Weights
+	if w == nil {
+		w = defaultWeights
+	}
+
+	free := freeTotal(l.State, u)
+	ul := make([]float64, len(l.State.Players()))
+	for i, p := range l.State.Players() {
+		ul[i] = f.Bias
+		for _, ft := range Features {
+			if weight := w[ft.Name]; weight != 0 {
+				ul[i] += weight * ft.Value(l.State, i)
+			}
+		}
+
+		lo := chipTotal(p.StashedTreasure, u)
+		ul[i] = math.Min(math.Max(ul[i], lo), lo+free)
+	}
+
+	return u.ofScores(ul), nil
+}
@@ -0,0 +1,104 @@
+package eval
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeatureValues(t *testing.T) {
+	exp := map[string]float64{
+		"stashed":        0,
+		"held":           5.5,
+		"held_at_risk":   0, // plenty of air to get back
+		"return_turns":   4.0 / 3,
+		"air_turns":      4,
+		"air_margin":     4 - 4.0/3,
+		"opponents_held": 0,
+		"ahead":          9.5 + 13.5,
+		"done":           0,
+	}
+
+	vl := FeatureValues(risky(), 0)
+	require.Len(t, vl, len(exp))
+	for i, v := range vl {
+		assert.InDelta(t, exp[Features[i].Name], v, 1e-9, Features[i].Name)
+	}
+}
+
+// TestFeaturedDefault checks that the default weights agree with Heuristic
+// in random positions.
+func TestFeaturedDefault(t *testing.T) {
+	s := state.NewStandardState(3)
+	rng := newRand(1, 0)
+	for s.Stage() != state.StageEndOfGame {
+		l := Leaf{State: s}
+		exp, err := Heuristic{}.Evaluate(l)
+		require.NoError(t, err)
+		ul, err := Featured{}.Evaluate(l)
+		require.NoError(t, err)
+		assert.InDeltaSlice(t, exp, ul, 1e-9)
+
+		vdl := s.ValidDecisions()
+		require.NoError(t, s.Do(vdl[rng.Intn(len(vdl))]))
+	}
+}
+
+func TestLoadWeights(t *testing.T) {
+	dir, err := ioutil.TempDir("", "weights")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "weights.json")
+	w := Weights{"held": 0.5, "air_margin": 2}
+	require.NoError(t, w.Save(path))
+	loaded, err := LoadWeights(path)
+	require.NoError(t, err)
+	assert.Equal(t, w, loaded)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"luck": 1}`), 0644))
+	_, err = LoadWeights(path)
+	assert.Error(t, err)
+
+	assert.Error(t, Weights{"luck": 1}.Validate())
+}
+
+// TestFeaturedBounds checks that projected scores stay within the bounds of
+// the utility with weights that would otherwise leave them, so that pruning
+// doesn't change the values of decisions.
+func TestFeaturedBounds(t *testing.T) {
+	leaf := Featured{Weights: Weights{"stashed": -1, "return_turns": -3},
+		Bias: 20}
+	rng := newRand(1, 0)
+	for players := 2; players <= 3; players++ {
+		s := state.NewStandardState(players)
+		for s.Stage() != state.StageEndOfGame {
+			l := Leaf{State: s}
+			ul, err := leaf.Evaluate(l)
+			require.NoError(t, err)
+			for i := range ul {
+				lo, hi := ExpectedScore{}.Bounds(s, i)
+				assert.True(t, ul[i] >= lo && ul[i] <= hi)
+			}
+
+			opts := Options{Depth: 3, Leaf: leaf, DisableSolver: true,
+				DisablePruning: true}
+			exp, err := Evaluate(s, opts)
+			require.NoError(t, err)
+			opts.DisablePruning = false
+			dm, err := Evaluate(s, opts)
+			require.NoError(t, err)
+			for d, eval := range exp {
+				assert.InDelta(t, eval, dm[d], 1e-9, "decision %s", d)
+			}
+
+			vdl := s.ValidDecisions()
+			require.NoError(t, s.Do(vdl[rng.Intn(len(vdl))]))
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package eval
+
+import (
+	"errors"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+)
+
+// Horizon is the number of rounds a search looks ahead, counting the current
+// round. Searches are cut off at the start of the round after the horizon.
+type Horizon int
+
+const (
+	// HorizonRound stops searching at the end of the current round, which
+	// avoids drift in the evaluation of longer-term positions. This is the
+	// default horizon.
+	HorizonRound Horizon = 1
+
+	// HorizonGame searches until the end of the game, which always has
+	// three rounds.
+	HorizonGame Horizon = 3
+)
+
+// lastRound returns the round at which searches from the given state stop.
+func (h Horizon) lastRound(s state.State) int {
+	if h <= 0 {
+		h = HorizonRound
+	}
+
+	return s.Round() + int(h)
+}
+
+// bonus wraps a built-in utility, adding a bonus to every player's score in
+// states where the game isn't over yet. The bonus estimates each player's
+// share of the treasure left on the board for future rounds, as the given
+// fraction of its total value split evenly between the players.
+type bonus struct {
+	scoreUtility
+	weight float64
+}
+
+func newBonus(u Utility, weight float64) (Utility, error) {
+	su, ok := u.(scoreUtility)
+	if !ok {
+		return nil, errors.New("bonus only supports built-in utilities")
+	}
+
+	return bonus{scoreUtility: su, weight: weight}, nil
+}
+
+func (b bonus) Utilities(s state.State) []float64 {
+	sl := scores(s, b)
+	if s.Stage() != state.StageEndOfGame {
+		var board float64
+		for _, t := range s.Tiles() {
+			if t.Treasure != nil {
+				board += chipTotal([]state.TreasureStack{*t.Treasure}, b)
+			}
+		}
+
+		for i := range sl {
+			sl[i] += b.weight * board / float64(len(sl))
+		}
+	}
+
+	return b.ofScores(sl)
+}
+
+// Bounds allows for the bonus in the upper bound of each player's score. The
+// treasure on the board can never be more than what's currently on the board
+// or held by divers, so the bonus can never be bigger than their share of it.
+func (b bonus) Bounds(s state.State, player int) (float64, float64) {
+	bl := scoreBounds(s, b)
+	for i := range bl {
+		free := bl[i].hi - bl[i].lo
+		bl[i].hi += b.weight * free / float64(len(bl))
+	}
+
+	return b.ofBounds(bl, player)
+}
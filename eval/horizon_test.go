@@ -0,0 +1,104 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHorizon(t *testing.T) {
+	s := state.NewStandardState(3)
+	for h, exp := range map[Horizon]int{0: 2, HorizonRound: 2, 2: 3, HorizonGame: 4} {
+		leaf := new(constant)
+		_, err := Evaluate(s, Options{Depth: 2, Horizon: h, Leaf: leaf})
+		require.NoError(t, err)
+		assert.Equal(t, exp, leaf.lastRound, "horizon %d", h)
+	}
+}
+
+func TestBonus(t *testing.T) {
+	s := state.NewStandardState(2)
+	u, err := newBonus(ExpectedScore{}, 0.5)
+	require.NoError(t, err)
+
+	// Nobody has stashed anything, so each player's utility is their share
+	// of the whole board's value.
+	var board float64
+	for _, t := range s.Tiles() {
+		if t.Treasure != nil {
+			board += chipTotal([]state.TreasureStack{*t.Treasure}, ExpectedScore{})
+		}
+	}
+	assert.InDeltaSlice(t, []float64{board / 4, board / 4}, u.Utilities(s), 1e-9)
+
+	// Only built-in utilities support bonuses.
+	custom := struct{ Utility }{ExpectedScore{}}
+	_, err = Evaluate(s, Options{Depth: 1, Bonus: 0.5, Utility: custom})
+	assert.Error(t, err)
+	_, err = Evaluate(s, Options{Depth: 1, Bonus: 0.5, Utility: Win{}})
+	assert.NoError(t, err)
+}
+
+// TestBonusBounds checks that the bounds of a utility with a bonus hold for
+// every state reachable in a random game, not just at the end of the game.
+func TestBonusBounds(t *testing.T) {
+	var utilities []Utility
+	for _, u := range []Utility{ExpectedScore{}, Score{}, Margin{}, Win{}, Rank{}} {
+		b, err := newBonus(u, 1)
+		require.NoError(t, err)
+		utilities = append(utilities, b)
+	}
+
+	s := state.NewStandardState(3)
+	rng := newRand(1, 0)
+	for i := 0; i < 10; i++ {
+		var history []state.State
+		for s.Stage() != state.StageEndOfGame {
+			history = append(history, state.NewStandardStateFrom(state.Snap(s)))
+			vdl := s.ValidDecisions()
+			require.NoError(t, s.Do(vdl[rng.Intn(len(vdl))]))
+		}
+		history = append(history, state.NewStandardStateFrom(state.Snap(s)))
+
+		for _, u := range utilities {
+			for j, hs := range history {
+				for _, later := range history[j:] {
+					ul := u.Utilities(later)
+					for p := range ul {
+						lo, hi := u.Bounds(hs, p)
+						assert.True(t, lo <= ul[p]+1e-9 && ul[p] <= hi+1e-9,
+							"%#v player %d: %v not in [%v, %v]", u, p, ul[p], lo, hi)
+					}
+				}
+			}
+		}
+
+		for range history[1:] {
+			require.NoError(t, s.Undo())
+		}
+	}
+}
+
+// TestEvaluateBonus checks that pruning is still exact with a bonus, which
+// relies on the bonus being accounted for in the utility's bounds.
+func TestEvaluateBonus(t *testing.T) {
+	s := endgame(t)
+	require.NoError(t, s.Do(state.Roll(2))) // player 0 has a drop decision
+
+	for _, u := range []Utility{ExpectedScore{}, Margin{}, Win{}} {
+		opts := Options{Depth: 100, Utility: u, Bonus: 0.5}
+		exp, err := Evaluate(s, opts)
+		require.NoError(t, err)
+
+		opts.DisablePruning = true
+		dm, err := Evaluate(s, opts)
+		require.NoError(t, err)
+
+		require.Len(t, dm, len(exp))
+		for d, eval := range exp {
+			assert.InDelta(t, eval, dm[d], 1e-9, "%T, decision %s", u, d)
+		}
+	}
+}
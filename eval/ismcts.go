@@ -0,0 +1,119 @@
+package eval
+
+import (
+	"math/rand"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+)
+
+// ISMCTS returns a map of valid decisions to their approximate expected score
+// for the current player, computed with an information-set Monte-Carlo tree
+// search. Unlike the other evaluators, it doesn't use the values of chips
+// that are hidden from the current player in a real game: it only uses the
+// values of the chips they hold or have stashed, and the types of everybody
+// else's. States don't record their history, so chips the player has seen
+// but no longer has, such as ones they dropped or lost at sea, are treated as
+// hidden too, which throws away some information a real player would have.
+//
+// Each iteration is played on a determinization of the state, in which the
+// values of hidden chips are dealt at random from the values the player
+// hasn't seen, and rewards are by default the actual scores of players in it.
+// Hidden values never affect which decisions are valid, so nodes of the search
+// tree (keyed by decisions) correspond to information sets of the player, and
+// statistics are aggregated over every determinization consistent with them.
+func ISMCTS(s state.State, opts MCTSOptions) (map[state.Decision]float64, error) {
+	if opts.Utility == nil {
+		opts.Utility = Score{}
+	}
+
+	mt := newMCTS(s, opts)
+	d := newDeterminizer(s, s.CurrentPlayer())
+	return mt.search(s, func() state.State {
+		return d.determinize(mt.rng)
+	})
+}
+
+// determinizer deals hidden treasure values from an observer's perspective.
+// Only the chips the observer holds or has stashed count as seen.
+type determinizer struct {
+	base     state.State
+	observer int
+	unseen   map[state.TreasureType][]int // values not seen by the observer
+}
+
+func newDeterminizer(s state.State, observer int) *determinizer {
+	d := determinizer{
+		base:     state.NewStandardStateFrom(state.Snap(s)),
+		observer: observer,
+		unseen:   make(map[state.TreasureType][]int),
+	}
+
+	for _, tt := range state.TreasureTypes() {
+		d.unseen[tt] = state.TreasureValues(tt)
+	}
+
+	// The observer knows the values of all of their own chips.
+	p := s.Players()[observer]
+	for _, tsl := range [][]state.TreasureStack{p.HeldTreasure, p.StashedTreasure} {
+		for _, ts := range tsl {
+			for _, t := range ts {
+				d.unseen[t.Type] = remove(d.unseen[t.Type], t.Value)
+			}
+		}
+	}
+
+	return &d
+}
+
+// determinize returns a new state in the observer's information set, with
+// the values of every chip the observer can't see dealt at random from the
+// values they haven't seen.
+func (d *determinizer) determinize(rng *rand.Rand) state.State {
+	deck := make(map[state.TreasureType][]int)
+	for _, tt := range state.TreasureTypes() {
+		vl := append([]int(nil), d.unseen[tt]...)
+		rng.Shuffle(len(vl), func(i, j int) { vl[i], vl[j] = vl[j], vl[i] })
+		deck[tt] = vl
+	}
+
+	deal := func(ts state.TreasureStack) {
+		for i := range ts {
+			tt := ts[i].Type
+			ts[i].Value = deck[tt][0]
+			deck[tt] = deck[tt][1:]
+		}
+	}
+
+	sn := state.Snap(d.base)
+	for _, t := range sn.Tiles {
+		if t.Treasure != nil {
+			deal(*t.Treasure)
+		}
+	}
+
+	for i, p := range sn.Players {
+		if i == d.observer {
+			continue
+		}
+
+		for _, ts := range p.HeldTreasure {
+			deal(ts)
+		}
+		for _, ts := range p.StashedTreasure {
+			deal(ts)
+		}
+	}
+
+	return state.NewStandardStateFrom(sn)
+}
+
+// remove returns the list with the first occurrence of the value removed.
+func remove(vl []int, v int) []int {
+	for i := range vl {
+		if vl[i] == v {
+			return append(vl[:i:i], vl[i+1:]...)
+		}
+	}
+
+	return vl
+}
@@ -0,0 +1,118 @@
+package eval
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeterminize(t *testing.T) {
+	s := endgame(t)
+	held := s.Players()[0].HeldTreasure
+	d := newDeterminizer(s, 0)
+
+	for i := 0; i < 100; i++ {
+		ds := d.determinize(rand.New(rand.NewSource(int64(i))))
+		require.NoError(t, state.Check(ds))
+
+		// Determinizations are the same position up to hidden values, and
+		// the observer's own chips are never changed.
+		assert.Equal(t,
+			state.Canonical(s, state.EquivalenceTreasureType),
+			state.Canonical(ds, state.EquivalenceTreasureType))
+		assert.Equal(t, held, ds.Players()[0].HeldTreasure)
+	}
+}
+
+// TestDeterminizeHidden checks that determinizations don't depend on the
+// values of chips that are hidden from the observer.
+func TestDeterminizeHidden(t *testing.T) {
+	s := endgame(t)
+	sn := state.Snap(s)
+	swapHidden(t, &sn)
+	other := state.NewStandardStateFrom(sn)
+	require.NotEqual(t, state.Canonical(s, 0), state.Canonical(other, 0))
+	require.Equal(t,
+		state.Canonical(s, state.EquivalenceTreasureType),
+		state.Canonical(other, state.EquivalenceTreasureType))
+
+	d, od := newDeterminizer(s, 0), newDeterminizer(other, 0)
+	for i := 0; i < 10; i++ {
+		ds := d.determinize(rand.New(rand.NewSource(int64(i))))
+		ods := od.determinize(rand.New(rand.NewSource(int64(i))))
+		assert.Equal(t, state.Canonical(ds, 0), state.Canonical(ods, 0))
+	}
+}
+
+// TestDeterminizeDropped checks that chips the observer has dropped are dealt
+// like any other chip they don't have, since states don't record that they
+// were seen.
+func TestDeterminizeDropped(t *testing.T) {
+	s := endgame(t)
+	do(t, s, state.Roll(2)) // player 0 has a drop decision
+	dropped := s.Players()[0].HeldTreasure[0]
+	do(t, s, state.Drop(0, true))
+	pos := s.Players()[0].Position
+	require.Equal(t, dropped, *s.Tiles()[pos].Treasure)
+
+	d := newDeterminizer(s, 0)
+	values := make(map[int]bool)
+	for i := 0; i < 100; i++ {
+		ds := d.determinize(rand.New(rand.NewSource(int64(i))))
+		ts := *ds.Tiles()[pos].Treasure
+		require.Len(t, ts, len(dropped))
+		assert.Equal(t, dropped[0].Type, ts[0].Type)
+		values[ts[0].Value] = true
+	}
+	assert.True(t, len(values) > 1)
+}
+
+// swapHidden swaps the values of two chips of the same type on the board with
+// different values, which are hidden from every player.
+func swapHidden(t *testing.T, sn *state.Snapshot) {
+	t.Helper()
+
+	var chips []*state.Treasure
+	for _, tl := range sn.Tiles {
+		if tl.Treasure == nil {
+			continue
+		}
+
+		for i := range *tl.Treasure {
+			chips = append(chips, &(*tl.Treasure)[i])
+		}
+	}
+
+	for i, a := range chips {
+		for _, b := range chips[i+1:] {
+			if a.Type == b.Type && a.Value != b.Value {
+				a.Value, b.Value = b.Value, a.Value
+				return
+			}
+		}
+	}
+
+	require.FailNow(t, "no chips with hidden values to swap")
+}
+
+// TestISMCTS checks that the player's own treasure is valued at its actual
+// value, in an endgame where they're all but certain to get it home.
+func TestISMCTS(t *testing.T) {
+	s := endgame(t)
+	do(t, s, state.Roll(2)) // player 0 has a drop decision
+
+	var exp float64
+	for _, ts := range s.Players()[0].HeldTreasure {
+		for _, tr := range ts {
+			exp += float64(tr.Value)
+		}
+	}
+
+	dm, err := ISMCTS(s, MCTSOptions{Iterations: 5000, Seed: 1})
+	require.NoError(t, err)
+	require.Len(t, dm, 3)
+	assert.InDelta(t, exp, dm[state.Drop(0, false)], 0.25)
+}
@@ -0,0 +1,227 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+)
+
+// LeafEvaluator estimates the utilities of states at which a search stops.
+type LeafEvaluator interface {
+	// Evaluate returns the estimated utility of each player at the given
+	// leaf. The leaf's state must be restored before returning.
+	Evaluate(l Leaf) ([]float64, error)
+}
+
+// DistributionEvaluator is a leaf evaluator that can also estimate how
+// spread out the utilities at a leaf are, which risk-sensitive searches need
+// (see EvaluateDistributions). Leaves evaluated by other evaluators are
+// treated as if their utilities were certain.
+type DistributionEvaluator interface {
+	LeafEvaluator
+
+	// Distribution returns an estimation of the utility of each player at
+	// the given leaf, with the same conditions as Evaluate.
+	Distribution(l Leaf) ([]Estimation, error)
+}
+
+// Leaf is a state at which a search has stopped, along with the parameters
+// of the search.
+type Leaf struct {
+	State     state.State
+	Player    int      // player the search is evaluating decisions for
+	LastRound int      // round at which the search is cut off
+	Utility   Utility  // utility the search is maximising
+	Opponents []Policy // models of opponents by seat, if any
+	Workers   int      // goroutines available to the evaluator
+	Seed      int64    // seed for any randomness, or zero for a random one
+}
+
+// utility returns the leaf's utility, which defaults to ExpectedScore.
+func (l Leaf) utility() Utility {
+	if l.Utility == nil {
+		return ExpectedScore{}
+	}
+
+	return l.Utility
+}
+
+// Rollouts estimates leaves by playing random games to the end of the round,
+// as Estimate does. This is the default leaf evaluator.
+type Rollouts struct {
+	// Iterations is the number of random games to play for each leaf. By
+	// default it's the same as Estimate's.
+	Iterations int
+
+	// Policy makes the decisions in random games, Uniform by default.
+	Policy Policy
+}
+
+func (r Rollouts) Evaluate(l Leaf) ([]float64, error) {
+	el, err := r.Distribution(l)
+	if err != nil {
+		return nil, err
+	}
+
+	return means(el), nil
+}
+
+func (r Rollouts) Distribution(l Leaf) ([]Estimation, error) {
+	// Modelled opponents play random games with their models.
+	policy := r.Policy
+	if l.Opponents != nil {
+		if policy == nil {
+			policy = Uniform{}
+		}
+		policy = seats{models: l.Opponents, rest: policy}
+	}
+
+	return estimateAll(l.State, l.Player, EstimateOptions{
+		Iterations: r.Iterations,
+		LastRound:  l.LastRound,
+		Utility:    l.utility(),
+		Policy:     policy,
+		Workers:    l.Workers,
+		Seed:       l.Seed,
+	})
+}
+
+// Heuristic estimates leaves from the treasure each player has, without any
+// searching. Each player's score is projected by counting stashed treasure in
+// full, and discounting held treasure by a rough guess at the odds of getting
+// it back to the submarine before the air runs out. Only the built-in
+// utilities are supported, which are applied to the projected scores.
+type Heuristic struct{}
+
+func (Heuristic) Evaluate(l Leaf) ([]float64, error) {
+	u, ok := l.utility().(scoreUtility)
+	if !ok {
+		return nil, errors.New("heuristic only supports built-in utilities")
+	}
+
+	s := l.State
+	cycles := airCycles(s)
+	ul := make([]float64, len(s.Players()))
+	for i := range ul {
+		stashed, held, lost := projection(s, i, cycles, u)
+		ul[i] = stashed + held - lost
+	}
+
+	return u.ofScores(ul), nil
+}
+
+// projection returns the parts of the given player's projected score, which
+// are the value of their stashed and held treasure, and the value of the held
+// treasure they're expected to lose at sea given the number of turns before
+// the air runs out. Chips are valued by the given utility. These are the
+// basis of both Heuristic and the corresponding Features.
+func projection(s state.State, player int, cycles float64, u scoreUtility) (
+	stashed, held, lost float64) {
+
+	p := s.Players()[player]
+	stashed = chipTotal(p.StashedTreasure, u)
+	held = chipTotal(p.HeldTreasure, u)
+	if held == 0 {
+		return stashed, 0, 0
+	}
+
+	return stashed, held, (1 - survival(p, cycles)) * held
+}
+
+// airCycles returns the number of turns every player can take before the air
+// runs out, since air is used up by every stack of held treasure on every
+// turn.
+func airCycles(s state.State) float64 {
+	var stacks int
+	for _, p := range s.Players() {
+		stacks += len(p.HeldTreasure)
+	}
+
+	return float64(s.Air()) / math.Max(1, float64(stacks))
+}
+
+// survival returns a rough guess at the odds of the given player making it
+// back to the submarine within the given number of turns.
+func survival(p state.Player, cycles float64) float64 {
+	if p.Done() {
+		return 1
+	}
+
+	// Divers move four spaces on average, less one for each stack they're
+	// holding, and have to turn around first.
+	distance, speed := returnDistance(p), diverSpeed(p)
+	return math.Min(1, cycles*speed/distance)
+}
+
+// returnDistance returns the given player's distance from the submarine,
+// counting turning around as a couple of spaces.
+func returnDistance(p state.Player) float64 {
+	distance := float64(p.Position)
+	if !p.TurnedAround {
+		distance += 2
+	}
+
+	return distance
+}
+
+// diverSpeed returns the expected number of spaces the given player moves
+// each turn.
+func diverSpeed(p state.Player) float64 {
+	return math.Max(1, 4-float64(len(p.HeldTreasure)))
+}
+
+// Default number of nodes Exact may search for a single leaf.
+const defaultExactNodes = 10000
+
+// errNodeLimit is returned by searches that exceed their node limit.
+var errNodeLimit = errors.New("search node limit exceeded")
+
+// Exact evaluates leaves by searching them to the end of the round, assuming
+// every player maximises their own utility, which is exact for small
+// endgames. Leaves that can't be searched within the node limit are passed
+// to the fallback evaluator instead.
+type Exact struct {
+	// MaxNodes is the maximum number of nodes to search for each leaf, or
+	// defaultExactNodes if it isn't positive.
+	MaxNodes int
+
+	// Fallback evaluates leaves that are too big to search, using Rollouts
+	// by default.
+	Fallback LeafEvaluator
+}
+
+func (e Exact) Evaluate(l Leaf) ([]float64, error) {
+	maxNodes := e.MaxNodes
+	if maxNodes <= 0 {
+		maxNodes = defaultExactNodes
+	}
+
+	sr := searcher{
+		player:    l.Player,
+		adversary: adversaryNone,
+		opponents: l.Opponents,
+		lastRound: l.LastRound,
+		maxNodes:  maxNodes,
+		utility:   l.utility(),
+		leafEval:  e.fallback(),
+		stats:     new(Stats),
+		ctx:       context.Background(),
+	}
+
+	ul, err := sr.value(l.State, completeDepth)
+	if err == errNodeLimit {
+		return e.fallback().Evaluate(l)
+	}
+
+	return ul, err
+}
+
+func (e Exact) fallback() LeafEvaluator {
+	if e.Fallback == nil {
+		return Rollouts{}
+	}
+
+	return e.Fallback
+}
@@ -0,0 +1,89 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// constant is a leaf evaluator that counts its calls, and records the round
+// at which the last leaf's search was cut off.
+type constant struct {
+	calls     int
+	lastRound int
+}
+
+func (c *constant) Evaluate(l Leaf) ([]float64, error) {
+	c.calls++
+	c.lastRound = l.LastRound
+	return make([]float64, len(l.State.Players())), nil
+}
+
+func TestExact(t *testing.T) {
+	s := endgame(t)
+	key := state.Canonical(s, 0)
+	leaf := Leaf{State: s, LastRound: s.Round() + 1}
+
+	ul, err := Exact{}.Evaluate(leaf)
+	require.NoError(t, err)
+	assert.Equal(t, key, state.Canonical(s, 0))
+
+	exp := bruteForce(t, s, 0, adversaryNone, s.Round())
+	assert.InDeltaSlice(t, exp, ul, 1e-9)
+
+	// Leaves that are too big are passed to the fallback.
+	fallback := new(constant)
+	ul, err = Exact{MaxNodes: 5, Fallback: fallback}.Evaluate(leaf)
+	require.NoError(t, err)
+	assert.Equal(t, 1, fallback.calls)
+	assert.Equal(t, []float64{0, 0}, ul)
+	assert.Equal(t, key, state.Canonical(s, 0))
+}
+
+func TestHeuristic(t *testing.T) {
+	s := endgame(t)
+	ul, err := Heuristic{}.Evaluate(Leaf{State: s, LastRound: s.Round() + 1})
+	require.NoError(t, err)
+	require.Len(t, ul, 2)
+
+	for i, p := range s.Players() {
+		lo := rawUtility(s, i)
+		assert.True(t, ul[i] >= lo)
+		assert.True(t, ul[i] <= lo+sum(p.HeldTreasure))
+	}
+
+	// The more air there is, the better the odds of getting home.
+	sn := state.Snap(s)
+	sn.Air = 0
+	low, err := Heuristic{}.Evaluate(Leaf{State: state.NewStandardStateFrom(sn)})
+	require.NoError(t, err)
+	sn.Air = 25
+	high, err := Heuristic{}.Evaluate(Leaf{State: state.NewStandardStateFrom(sn)})
+	require.NoError(t, err)
+	for i := range ul {
+		assert.True(t, low[i] <= ul[i] && ul[i] <= high[i])
+	}
+}
+
+func TestEvaluateLeaf(t *testing.T) {
+	s := endgame(t)
+	require.NoError(t, s.Do(state.Roll(2))) // player 0 has a drop decision
+
+	exp, err := Evaluate(s, Options{Depth: 100, Mode: ModeMaxN})
+	require.NoError(t, err)
+
+	// Exact leaves make any depth of search exact.
+	dm, err := Evaluate(s, Options{Depth: 1, Mode: ModeMaxN, Leaf: Exact{}})
+	require.NoError(t, err)
+	require.Len(t, dm, len(exp))
+	for d, eval := range exp {
+		assert.InDelta(t, eval, dm[d], 1e-9, "decision %s", d)
+	}
+
+	leaf := new(constant)
+	_, err = Evaluate(state.NewStandardState(3), Options{Depth: 2, Leaf: leaf})
+	require.NoError(t, err)
+	assert.True(t, leaf.calls > 0)
+}
@@ -0,0 +1,284 @@
+package eval
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+)
+
+// Number of iterations to run a Monte-Carlo tree search for if neither an
+// iteration count nor a time budget is configured.
+const defaultMCTSIterations = 1000
+
+// MCTSOptions configures a Monte-Carlo tree search.
+type MCTSOptions struct {
+	// Iterations is the maximum number of playouts to run.
+	Iterations int
+
+	// Duration is the maximum wall-clock time to search for. If both this
+	// and Iterations are set, the search stops at whichever comes first.
+	Duration time.Duration
+
+	// Exploration is the UCT exploration constant. Rewards are normalised
+	// to [0, 1] by the range observed so far, and the default is sqrt(2).
+	Exploration float64
+
+	// Utility is the reward for playouts, by default the expected score of
+	// each player for MCTS and the actual score for ISMCTS.
+	Utility Utility
+
+	// Policy makes the decisions in playouts, Uniform by default.
+	Policy Policy
+
+	// Horizon is the number of rounds to search, by default just the
+	// current one.
+	Horizon Horizon
+
+	// Seed, if non-zero, seeds the search so that its results are
+	// deterministic when it's limited by iterations alone.
+	Seed int64
+}
+
+// MCTS returns a map of valid decisions to their approximate expected utility
+// for the current player, computed with a Monte-Carlo tree search using UCT.
+// Every player is assumed to maximise their own utility, so nodes keep track
+// of the total reward of each player and choose between their children from
+// the point of view of whoever is deciding. Rolls are sampled from the dice
+// distribution. As with Evaluate, the search stops at the horizon.
+// Decisions that were never tried are left out of the map.
+func MCTS(s state.State, opts MCTSOptions) (map[state.Decision]float64, error) {
+	if opts.Utility == nil {
+		opts.Utility = ExpectedScore{}
+	}
+
+	mt := newMCTS(s, opts)
+	return mt.search(s, func() state.State { return s })
+}
+
+func newMCTS(s state.State, opts MCTSOptions) *mcts {
+	if opts.Iterations <= 0 && opts.Duration <= 0 {
+		opts.Iterations = defaultMCTSIterations
+	}
+	if opts.Exploration <= 0 {
+		opts.Exploration = math.Sqrt2
+	}
+	if opts.Policy == nil {
+		opts.Policy = Uniform{}
+	}
+	seed := opts.Seed
+	if seed == 0 {
+		seed = newSeed()
+	}
+
+	return &mcts{
+		opts:      opts,
+		lastRound: opts.Horizon.lastRound(s),
+		rng:       rand.New(rand.NewSource(seed)),
+		min:       math.Inf(1),
+		max:       math.Inf(-1),
+	}
+}
+
+// search runs the configured number of iterations of the search from the
+// given state. Each iteration is run on the state returned by sample, which
+// must be in the same position as the given state (up to hidden information).
+func (mt *mcts) search(s state.State, sample func() state.State) (
+	map[state.Decision]float64, error) {
+
+	root := mt.newNode(s)
+	start := time.Now()
+	for i := 0; mt.opts.Iterations <= 0 || i < mt.opts.Iterations; i++ {
+		if mt.opts.Duration > 0 && time.Since(start) >= mt.opts.Duration {
+			break
+		}
+
+		if err := mt.iterate(sample(), root); err != nil {
+			return nil, err
+		}
+	}
+
+	player := s.CurrentPlayer()
+	dm := make(map[state.Decision]float64)
+	for i, c := range root.children {
+		if c != nil && c.visits > 0 {
+			dm[root.decisions[i]] = c.total[player] / float64(c.visits)
+		}
+	}
+
+	return dm, nil
+}
+
+// mcts holds the parameters of a single Monte-Carlo tree search.
+type mcts struct {
+	opts      MCTSOptions
+	lastRound int        // round at which playouts stop
+	rng       *rand.Rand // source of randomness
+	min, max  float64    // range of rewards observed
+}
+
+// mctsNode is a node in the search tree. Children are created lazily, and
+// are stored in the same order as the valid decisions at the node.
+type mctsNode struct {
+	decisions []state.Decision
+	children  []*mctsNode
+	chance    bool      // whether the node is a roll stage
+	player    int       // player making the decision at the node
+	visits    int       // number of playouts through the node
+	total     []float64 // total reward of playouts by player
+}
+
+func (mt *mcts) newNode(s state.State) *mctsNode {
+	n := &mctsNode{
+		chance: s.Stage() == state.StageRoll,
+		player: s.CurrentPlayer(),
+		total:  make([]float64, len(s.Players())),
+	}
+
+	if !mt.isTerminal(s) {
+		n.decisions = s.ValidDecisions()
+		n.children = make([]*mctsNode, len(n.decisions))
+	}
+
+	return n
+}
+
+// iterate runs a single selection, expansion, playout and backpropagation
+// step of the search from the given root node.
+func (mt *mcts) iterate(s state.State, root *mctsNode) error {
+	path := []*mctsNode{root}
+	n := root
+	for len(n.decisions) > 0 {
+		i, expand := mt.selectChild(n)
+		if err := s.Do(n.decisions[i]); err != nil {
+			return err
+		}
+
+		if expand {
+			n.children[i] = mt.newNode(s)
+		}
+
+		n = n.children[i]
+		path = append(path, n)
+		if expand {
+			break
+		}
+	}
+
+	ul, err := playout(s, mt.lastRound, mt.opts.Utility, mt.opts.Policy, mt.rng)
+	for range path[1:] {
+		if err := s.Undo(); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, u := range ul {
+		mt.min = math.Min(mt.min, u)
+		mt.max = math.Max(mt.max, u)
+	}
+
+	for _, n := range path {
+		n.visits++
+		for i, u := range ul {
+			n.total[i] += u
+		}
+	}
+
+	return nil
+}
+
+// selectChild returns the index of the child of the given node to descend
+// into, and whether the child needs to be created first. Chance nodes sample
+// their children from the dice distribution, and choice nodes try each child
+// once before picking the one with the best upper confidence bound for the
+// player making the decision.
+func (mt *mcts) selectChild(n *mctsNode) (int, bool) {
+	if n.chance {
+		i := sampleRoll(n.decisions, mt.rng)
+		return i, n.children[i] == nil
+	}
+
+	for i, c := range n.children {
+		if c == nil {
+			return i, true
+		}
+	}
+
+	scale := mt.max - mt.min
+	if scale <= 0 {
+		scale = 1
+	}
+
+	best, bestUCB := 0, math.Inf(-1)
+	logN := math.Log(float64(n.visits))
+	for i, c := range n.children {
+		mean := c.total[n.player] / float64(c.visits)
+		ucb := (mean-mt.min)/scale +
+			mt.opts.Exploration*math.Sqrt(logN/float64(c.visits))
+
+		if ucb > bestUCB {
+			best, bestUCB = i, ucb
+		}
+	}
+
+	return best, false
+}
+
+func (mt *mcts) isTerminal(s state.State) bool {
+	return s.Round() >= mt.lastRound || s.Stage() == state.StageEndOfGame
+}
+
+// playout plays the given state until the start of the given round with
+// decisions made by the given policy and dice rolls sampled from the dice
+// distribution, returning the utility of each player at the end. The state is
+// restored before returning.
+func playout(s state.State, lastRound int, utility Utility, policy Policy,
+	rng *rand.Rand) ([]float64, error) {
+
+	var n int
+	var err error
+	for s.Round() < lastRound && s.Stage() != state.StageEndOfGame {
+		var d state.Decision
+		if s.Stage() == state.StageRoll {
+			vdl := s.ValidDecisions()
+			d = vdl[sampleRoll(vdl, rng)]
+		} else if d, err = policy.Decide(s, rng); err != nil {
+			break
+		}
+
+		if err = s.Do(d); err != nil {
+			break
+		}
+		n++
+	}
+
+	var ul []float64
+	if err == nil {
+		ul = utility.Utilities(s)
+	}
+
+	for ; n > 0; n-- {
+		if err := s.Undo(); err != nil {
+			return nil, err
+		}
+	}
+
+	return ul, err
+}
+
+// sampleRoll returns the index of a roll decision in the given list, sampled
+// from the dice distribution.
+func sampleRoll(vdl []state.Decision, rng *rand.Rand) int {
+	roll := state.Roll(2 + rng.Intn(3) + rng.Intn(3))
+	for i, vd := range vdl {
+		if vd == roll {
+			return i
+		}
+	}
+
+	panic("roll missing from valid decisions") // should never happen
+}
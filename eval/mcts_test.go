@@ -0,0 +1,63 @@
+package eval
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMCTSConvergence checks that MCTS converges to the exact max-n values
+// of an endgame small enough to search exhaustively.
+func TestMCTSConvergence(t *testing.T) {
+	s := endgame(t)
+	do(t, s, state.Roll(2)) // player 0 has a drop decision
+
+	exp, err := Evaluate(s, Options{Depth: 100, Mode: ModeMaxN})
+	require.NoError(t, err)
+
+	dm, err := MCTS(s, MCTSOptions{Iterations: 20000, Seed: 1})
+	require.NoError(t, err)
+
+	require.Len(t, dm, len(exp))
+	for d, eval := range exp {
+		assert.InDelta(t, eval, dm[d], 0.1, "decision %s", d)
+	}
+}
+
+func TestMCTSDuration(t *testing.T) {
+	s := state.NewStandardState(4)
+
+	start := time.Now()
+	dm, err := MCTS(s, MCTSOptions{Duration: 50 * time.Millisecond})
+	require.NoError(t, err)
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Len(t, dm, 5)
+}
+
+func TestMCTSSeed(t *testing.T) {
+	s := state.NewStandardState(3)
+	opts := MCTSOptions{Iterations: 200, Seed: 3}
+
+	exp, err := MCTS(s, opts)
+	require.NoError(t, err)
+	dm, err := MCTS(s, opts)
+	require.NoError(t, err)
+	assert.Equal(t, exp, dm)
+}
+
+func TestPlayout(t *testing.T) {
+	s := state.NewStandardState(3)
+	key := state.Canonical(s, 0)
+	rng := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 100; i++ {
+		ul, err := playout(s, 2, ExpectedScore{}, Uniform{}, rng)
+		require.NoError(t, err)
+		require.Len(t, ul, 3)
+		require.Equal(t, key, state.Canonical(s, 0))
+	}
+}
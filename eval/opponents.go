@@ -0,0 +1,171 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+)
+
+// Stochastic is a policy that knows the probability of each of its
+// decisions, so that searches can take the expectation over them rather than
+// sampling a single one.
+type Stochastic interface {
+	Policy
+
+	// Probabilities returns the probability of the policy making each of
+	// the valid decisions in the given state, which is never a roll stage.
+	// Decisions that are left out have zero probability.
+	Probabilities(s state.State) (map[state.Decision]float64, error)
+}
+
+// opponents returns the models of the given player's opponents by seat, or
+// nil if none of them are modelled.
+func opponents(models []Policy, player int) []Policy {
+	var res []Policy
+	for i, m := range models {
+		if m == nil || i == player {
+			continue
+		}
+		if res == nil {
+			res = make([]Policy, len(models))
+		}
+
+		res[i] = m
+	}
+
+	return res
+}
+
+// model returns the model of the given player, or nil if they're not
+// modelled.
+func (sr *searcher) model(player int) Policy {
+	if player >= len(sr.opponents) {
+		return nil
+	}
+
+	return sr.opponents[player]
+}
+
+// modelled returns true if the decision in the given state is made by a
+// modelled opponent.
+func (sr *searcher) modelled(s state.State) bool {
+	return s.Stage() != state.StageRoll &&
+		s.Stage() != state.StageEndOfGame &&
+		sr.model(s.CurrentPlayer()) != nil
+}
+
+// distribution returns the probability of each valid decision in the given
+// state, which must be modelled, in the order of the valid decisions. Models
+// that aren't Stochastic are assumed to be deterministic, and are asked for a
+// decision with randomness derived from the state. Stochastic probabilities
+// are normalised over the valid decisions, and it's an error if a model puts
+// no weight on any of them.
+func (sr *searcher) distribution(s state.State) ([]state.Decision,
+	[]float64, error) {
+
+	cp := s.CurrentPlayer()
+	vdl := s.ValidDecisions()
+	pl := make([]float64, len(vdl))
+	m := sr.model(cp)
+	if st, ok := m.(Stochastic); ok {
+		pm, err := st.Probabilities(s)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var total float64
+		for i, vd := range vdl {
+			if p := pm[vd]; p < 0 || math.IsNaN(p) || math.IsInf(p, 0) {
+				return nil, nil, fmt.Errorf(
+					"model of player %d gave %s invalid probability %v",
+					cp, vd, p)
+			}
+
+			pl[i] = pm[vd]
+			total += pl[i]
+		}
+		if total == 0 || math.IsInf(total, 0) {
+			return nil, nil, fmt.Errorf(
+				"model of player %d gave no valid decision a probability", cp)
+		}
+
+		for i := range pl {
+			pl[i] /= total
+		}
+
+		return vdl, pl, nil
+	}
+
+	d, err := m.Decide(s, newRand(sr.seed^int64(state.Hash(s, 0)), 0))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i, vd := range vdl {
+		if vd == d {
+			pl[i] = 1
+			return vdl, pl, nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("model of player %d made invalid decision %s",
+		cp, d)
+}
+
+// expectation returns the expected value of the given modelled state, which
+// is the value of each decision weighted by the probability of the model
+// making it. Values are computed by the given function on the state that
+// results from each decision.
+func (sr *searcher) expectation(s state.State,
+	value func() ([]float64, error)) ([]float64, error) {
+
+	vdl, pl, err := sr.distribution(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var exp []float64
+	for i, vd := range vdl {
+		if pl[i] == 0 {
+			continue
+		}
+
+		if err := s.Do(vd); err != nil {
+			return nil, err
+		}
+
+		v, err := value()
+		if err := s.Undo(); err != nil {
+			return nil, err
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if exp == nil {
+			exp = make([]float64, len(v))
+		}
+		for j := range exp {
+			exp[j] += pl[i] * v[j]
+		}
+	}
+
+	return exp, nil
+}
+
+// seats is a rollout policy in which modelled players make decisions with
+// their models, and everyone else with the default policy.
+type seats struct {
+	models []Policy
+	rest   Policy
+}
+
+func (st seats) Decide(s state.State, rng *rand.Rand) (state.Decision, error) {
+	if cp := s.CurrentPlayer(); cp < len(st.models) && st.models[cp] != nil {
+		return st.models[cp].Decide(s, rng)
+	}
+
+	return st.rest.Decide(s, rng)
+}
@@ -0,0 +1,193 @@
+package eval
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// last is a deterministic policy that always makes the last valid decision.
+type last struct{}
+
+func (last) Decide(s state.State, rng *rand.Rand) (state.Decision, error) {
+	vdl := s.ValidDecisions()
+	return vdl[len(vdl)-1], nil
+}
+
+// bruteForceModel computes the utilities of the given state like bruteForce,
+// except that every player other than the given one is modelled by the given
+// probabilities.
+func bruteForceModel(t *testing.T, s state.State, player, round int,
+	model func(s state.State) map[state.Decision]float64) []float64 {
+
+	if s.Round() > round || s.Stage() == state.StageEndOfGame {
+		return rawUtilities(s)
+	}
+
+	pm := rollProbabilities
+	if s.Stage() != state.StageRoll && s.CurrentPlayer() != player {
+		pm = model(s)
+	}
+
+	var best []float64
+	exp := make([]float64, len(s.Players()))
+	for _, vd := range s.ValidDecisions() {
+		require.NoError(t, s.Do(vd))
+		v := bruteForceModel(t, s, player, round, model)
+		require.NoError(t, s.Undo())
+
+		for i := range exp {
+			exp[i] += pm[vd] * v[i]
+		}
+		if best == nil || v[player] > best[player] {
+			best = v
+		}
+	}
+
+	if s.Stage() == state.StageRoll || s.CurrentPlayer() != player {
+		return exp
+	}
+
+	return best
+}
+
+// TestEvaluateOpponents checks that searches with every opponent modelled
+// match a brute force computation, whatever the search mode.
+func TestEvaluateOpponents(t *testing.T) {
+	s := endgame(t)
+	require.NoError(t, s.Do(state.Roll(2))) // player 0 has a drop decision
+
+	models := map[string]struct {
+		policy Policy
+		model  func(s state.State) map[state.Decision]float64
+	}{
+		"uniform": {Uniform{}, func(s state.State) map[state.Decision]float64 {
+			pm, err := Uniform{}.Probabilities(s)
+			require.NoError(t, err)
+			return pm
+		}},
+		"last": {last{}, func(s state.State) map[state.Decision]float64 {
+			vdl := s.ValidDecisions()
+			return map[state.Decision]float64{vdl[len(vdl)-1]: 1}
+		}},
+	}
+
+	for name, m := range models {
+		modes := []Mode{ModeParanoid, ModeMaxN, ModeBestReply}
+		for _, mode := range modes {
+			for _, disable := range []bool{false, true} {
+				dm, err := Evaluate(s, Options{
+					Depth:          100,
+					Mode:           mode,
+					DisablePruning: disable,
+					Opponents:      []Policy{nil, m.policy},
+					Table:          NewTable(1 << 10),
+				})
+				require.NoError(t, err)
+
+				for _, vd := range s.ValidDecisions() {
+					require.NoError(t, s.Do(vd))
+					exp := bruteForceModel(t, s, 0, s.Round(), m.model)
+					require.NoError(t, s.Undo())
+
+					assert.InDelta(t, exp[0], dm[vd], 1e-9,
+						"%s, mode %d, decision %s", name, mode, vd)
+				}
+			}
+		}
+	}
+}
+
+// TestOpponentsOwnSeat checks that the evaluating player is never modelled.
+func TestOpponentsOwnSeat(t *testing.T) {
+	s := endgame(t)
+	require.NoError(t, s.Do(state.Roll(2))) // player 0 has a drop decision
+
+	exp, err := Evaluate(s, Options{Depth: 100, Mode: ModeMaxN})
+	require.NoError(t, err)
+	dm, err := Evaluate(s, Options{Depth: 100, Mode: ModeMaxN,
+		Opponents: []Policy{last{}}})
+	require.NoError(t, err)
+	assert.Equal(t, exp, dm)
+}
+
+// fixed is a stochastic policy with the given probabilities in every state.
+type fixed map[state.Decision]float64
+
+func (f fixed) Decide(s state.State, rng *rand.Rand) (state.Decision, error) {
+	return s.ValidDecisions()[0], nil
+}
+
+func (f fixed) Probabilities(s state.State) (map[state.Decision]float64,
+	error) {
+
+	return f, nil
+}
+
+// doubled is a stochastic policy like Uniform, but with probabilities that
+// add up to two.
+type doubled struct {
+	Uniform
+}
+
+func (d doubled) Probabilities(s state.State) (map[state.Decision]float64,
+	error) {
+
+	pm, err := d.Uniform.Probabilities(s)
+	for vd := range pm {
+		pm[vd] *= 2
+	}
+
+	return pm, err
+}
+
+// invalid is a deterministic policy that always makes an invalid decision.
+type invalid struct{}
+
+func (invalid) Decide(s state.State, rng *rand.Rand) (state.Decision, error) {
+	return state.Roll(1), nil
+}
+
+// TestOpponentsInvalid checks that it's an error for models to give no valid
+// decisions, and that stochastic models are normalised.
+func TestOpponentsInvalid(t *testing.T) {
+	s := state.NewStandardState(2)
+	do(t, s, state.Roll(3)) // player 0 has a pick up decision
+
+	for _, mode := range []Mode{ModeParanoid, ModeMaxN} {
+		opts := Options{Depth: 4, Mode: mode, Leaf: new(constant)}
+		models := []Policy{fixed{state.Roll(1): 1}, fixed{}, invalid{}}
+		for _, m := range models {
+			opts.Opponents = []Policy{nil, m}
+			_, err := Evaluate(s, opts)
+			assert.Error(t, err, "mode %d, model %#v", mode, m)
+		}
+
+		opts.Opponents = []Policy{nil, Uniform{}}
+		exp, err := Evaluate(s, opts)
+		require.NoError(t, err)
+		opts.Opponents = []Policy{nil, doubled{}}
+		dm, err := Evaluate(s, opts)
+		require.NoError(t, err)
+		for d, eval := range exp {
+			assert.InDelta(t, eval, dm[d], 1e-9, "mode %d, decision %s",
+				mode, d)
+		}
+	}
+}
+
+func TestSeats(t *testing.T) {
+	s := endgame(t)
+	require.NoError(t, s.Do(state.Roll(2))) // player 0 has a drop decision
+
+	rng := newRand(1, 0)
+	policy := seats{models: []Policy{nil, Uniform{}}, rest: last{}}
+	for i := 0; i < 10; i++ {
+		d, err := policy.Decide(s, rng)
+		require.NoError(t, err)
+		assert.Equal(t, state.Drop(1, true), d)
+	}
+}
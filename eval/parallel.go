@@ -0,0 +1,192 @@
+package eval
+
+import (
+	"sync"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+)
+
+// rootValues returns a map of the valid decisions in the given state to their
+// value for the player, as computed by the given function on the state that
+// results from making them. With multiple workers, decisions are split between
+// goroutines that each search their own copy of the state with their own copy
+// of the searcher, and workers left over are used for leaf estimation. States
+// that can't be cloned are searched by a single worker.
+func (sr *searcher) rootValues(s state.State,
+	value func(sr *searcher, s state.State) (float64, error)) (
+	map[state.Decision]float64, error) {
+
+	vdl := s.ValidDecisions()
+	vl := make([]float64, len(vdl))
+	workers := sr.workers
+	if workers > len(vdl) {
+		workers = len(vdl)
+	}
+	if _, ok := s.(state.Cloner); !ok {
+		workers = 1
+	}
+
+	if workers <= 1 {
+		for i, vd := range vdl {
+			if err := s.Do(vd); err != nil {
+				return nil, err
+			}
+
+			v, err := sr.rootValue(s, vd, value)
+			if err := s.Undo(); err != nil {
+				return nil, err
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			vl[i] = v
+		}
+
+		return decisionMap(vdl, vl), nil
+	}
+
+	srl := make([]searcher, workers)
+	errl := make([]error, workers)
+	next := make(chan int, len(vdl))
+	for i := range vdl {
+		next <- i
+	}
+	close(next)
+
+	var wg sync.WaitGroup
+	for w := range srl {
+		srl[w] = *sr
+		srl[w].workers = 1
+		srl[w].leafWorkers = sr.workers / workers
+		srl[w].stats = new(Stats)
+		srl[w].truncated = false
+
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			ws := s.(state.Cloner).Clone()
+			for i := range next {
+				if err := ws.Do(vdl[i]); err != nil {
+					errl[w] = err
+					return
+				}
+
+				v, err := srl[w].rootValue(ws, vdl[i], value)
+				if err := ws.Undo(); err != nil {
+					errl[w] = err
+					return
+				}
+				if err != nil {
+					errl[w] = err
+					return
+				}
+
+				vl[i] = v
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for w := range srl {
+		sr.stats.add(srl[w].stats)
+		sr.truncated = sr.truncated || srl[w].truncated
+	}
+	for _, err := range errl {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return decisionMap(vdl, vl), nil
+}
+
+// rootValue calls the value function on the state resulting from the given
+// root decision, recording the work done below it if the search has roots.
+func (sr *searcher) rootValue(s state.State, d state.Decision,
+	value func(sr *searcher, s state.State) (float64, error)) (float64, error) {
+
+	r := sr.roots[d]
+	if r == nil {
+		return value(sr, s)
+	}
+
+	stats, truncated := *sr.stats, sr.truncated
+	sr.truncated = false
+	v, err := value(sr, s)
+	r.stats.add(sr.stats.since(stats))
+	r.truncated = r.truncated || sr.truncated
+	sr.truncated = sr.truncated || truncated
+
+	return v, err
+}
+
+// rollouts plays random games with the given indices from the given state
+// until the start of the given round using the given policy, returning the
+// utilities at the end of each. Games are split between workers that each
+// play on their own copy of the state, or played by one worker if the state
+// can't be cloned. The random numbers used by each game depend only on its
+// index and the seed, so results are independent of the number of workers.
+func rollouts(s state.State, lastRound, first, games, workers int,
+	utility Utility, policy Policy, seed int64) ([][]float64, error) {
+
+	ull := make([][]float64, games)
+	if workers > games {
+		workers = games
+	}
+	if _, ok := s.(state.Cloner); !ok {
+		workers = 1
+	}
+
+	if workers <= 1 {
+		for i := range ull {
+			var err error
+			ull[i], err = playout(s, lastRound, utility, policy,
+				newRand(seed, first+i))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return ull, nil
+	}
+
+	errl := make([]error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			ws := s.(state.Cloner).Clone()
+			for i := w; i < games; i += workers {
+				var err error
+				ull[i], err = playout(ws, lastRound, utility, policy,
+					newRand(seed, first+i))
+				if err != nil {
+					errl[w] = err
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for _, err := range errl {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ull, nil
+}
+
+func decisionMap(vdl []state.Decision, vl []float64) map[state.Decision]float64 {
+	dm := make(map[state.Decision]float64)
+	for i, vd := range vdl {
+		dm[vd] = vl[i]
+	}
+
+	return dm
+}
@@ -0,0 +1,100 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEvaluateWorkers checks that splitting an exact search between workers
+// doesn't change its results or the amount of work done.
+func TestEvaluateWorkers(t *testing.T) {
+	s := endgame(t)
+	require.NoError(t, s.Do(state.Roll(2))) // player 0 has a drop decision
+	key := state.Canonical(s, 0)
+
+	modes := []Mode{ModeParanoid, ModeMaxN, ModeBestReply}
+	for _, mode := range modes {
+		var stats, parStats Stats
+		exp, err := Evaluate(s, Options{Depth: 100, Mode: mode, Stats: &stats})
+		require.NoError(t, err)
+
+		dm, err := Evaluate(s, Options{Depth: 100, Mode: mode, Workers: 4,
+			Stats: &parStats})
+		require.NoError(t, err)
+		assert.Equal(t, key, state.Canonical(s, 0))
+		assert.Equal(t, stats, parStats)
+
+		require.Len(t, dm, len(exp))
+		for d, eval := range exp {
+			assert.InDelta(t, eval, dm[d], 1e-9, "decision %s", d)
+		}
+	}
+}
+
+// opaque is a state that can't be cloned, which counts the decisions made
+// with it.
+type opaque struct {
+	state.State
+	decisions int
+}
+
+func (o *opaque) Do(d state.Decision) error {
+	o.decisions++
+	return o.State.Do(d)
+}
+
+// TestEvaluateOpaque checks that states which can't be cloned are searched
+// themselves, rather than copied into a different implementation.
+func TestEvaluateOpaque(t *testing.T) {
+	s := endgame(t)
+	require.NoError(t, s.Do(state.Roll(2))) // player 0 has a drop decision
+	exp, err := Evaluate(s, Options{Depth: 100})
+	require.NoError(t, err)
+
+	o := &opaque{State: s}
+	dm, err := Evaluate(o, Options{Depth: 100, Workers: 4})
+	require.NoError(t, err)
+	assert.Equal(t, exp, dm)
+	assert.True(t, o.decisions > 0)
+
+	_, err = Estimate(o, 0, EstimateOptions{Iterations: 10, Workers: 4})
+	require.NoError(t, err)
+}
+
+// TestEvaluateSeed checks that seeded searches with monte-carlo leaves are
+// deterministic, however many workers they're split between.
+func TestEvaluateSeed(t *testing.T) {
+	s := state.NewStandardState(3)
+
+	exp, err := Evaluate(s, Options{Depth: 2, Seed: 42})
+	require.NoError(t, err)
+
+	for _, workers := range []int{1, 2, 16} {
+		dm, err := Evaluate(s, Options{Depth: 2, Seed: 42, Workers: workers})
+		require.NoError(t, err)
+		assert.Equal(t, exp, dm, "%d workers", workers)
+	}
+}
+
+func TestEstimateSeed(t *testing.T) {
+	s := state.NewStandardState(4)
+	opts := EstimateOptions{Iterations: 50, LastRound: 10, Seed: 7}
+
+	exp, err := Estimate(s, 0, opts)
+	require.NoError(t, err)
+
+	for _, workers := range []int{2, 3, 64} {
+		opts.Workers = workers
+		util, err := Estimate(s, 0, opts)
+		require.NoError(t, err)
+		assert.Equal(t, exp, util, "%d workers", workers)
+	}
+
+	opts.Seed++
+	util, err := Estimate(s, 0, opts)
+	require.NoError(t, err)
+	assert.NotEqual(t, exp, util)
+}
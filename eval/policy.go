@@ -0,0 +1,84 @@
+package eval
+
+import (
+	"math/rand"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+)
+
+// Policy chooses decisions for the players of random games.
+type Policy interface {
+	// Decide returns one of the valid decisions in the given state, which
+	// is never a roll stage. The state must be unchanged when it returns.
+	Decide(s state.State, rng *rand.Rand) (state.Decision, error)
+}
+
+// Uniform is a policy that chooses between valid decisions uniformly at
+// random. This is the default policy for random games.
+type Uniform struct{}
+
+func (Uniform) Decide(s state.State, rng *rand.Rand) (state.Decision, error) {
+	vdl := s.ValidDecisions()
+	return vdl[rng.Intn(len(vdl))], nil
+}
+
+func (Uniform) Probabilities(s state.State) (map[state.Decision]float64,
+	error) {
+
+	vdl := s.ValidDecisions()
+	pm := make(map[state.Decision]float64)
+	for _, vd := range vdl {
+		pm[vd] = 1 / float64(len(vdl))
+	}
+
+	return pm, nil
+}
+
+// Cautious is a light rule-based policy that plays more like a real player
+// than Uniform, without any searching. Divers pick up treasure on the way
+// down until they're carrying a few stacks, and turn around once the air
+// that's left is low compared to how deep they are. They never drop treasure.
+type Cautious struct{}
+
+// Number of stacks of treasure a cautious diver is happy to carry.
+const cautiousStacks = 2
+
+func (Cautious) Decide(s state.State, rng *rand.Rand) (state.Decision, error) {
+	p := s.Players()[s.CurrentPlayer()]
+	switch s.Stage() {
+	case state.StageTurn:
+		return state.Turn(cautiousTurn(s, p)), nil
+
+	case state.StagePickUp:
+		pu := len(p.HeldTreasure) < cautiousStacks && !cautiousTurn(s, p)
+		return state.PickUp(pu), nil
+	}
+
+	return state.Drop(0, false), nil
+}
+
+// cautiousTurn returns true if the given player should head back to the
+// submarine, i.e. they're carrying enough treasure or running out of air.
+// Air runs out faster the more treasure is being carried, and divers move
+// slower the more they themselves are carrying.
+func cautiousTurn(s state.State, p state.Player) bool {
+	if p.Position == len(s.Tiles())-1 {
+		return true
+	}
+	if len(p.HeldTreasure) == 0 {
+		return false
+	}
+
+	var stacks int
+	for _, op := range s.Players() {
+		stacks += len(op.HeldTreasure)
+	}
+
+	speed := 4 - len(p.HeldTreasure)
+	if speed < 1 {
+		speed = 1
+	}
+
+	turns := (p.Position + speed - 1) / speed
+	return len(p.HeldTreasure) >= cautiousStacks || turns*stacks >= s.Air()
+}
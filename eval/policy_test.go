@@ -0,0 +1,67 @@
+package eval
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPolicies plays random games with each policy, checking that they only
+// ever make valid decisions.
+func TestPolicies(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, policy := range []Policy{Uniform{}, Cautious{}} {
+		for i := 0; i < 20; i++ {
+			s := state.NewStandardState(2 + i%5)
+			ul, err := playout(s, 10, ExpectedScore{}, policy, rng)
+			require.NoError(t, err)
+			assert.Len(t, ul, len(s.Players()))
+		}
+	}
+}
+
+func TestCautious(t *testing.T) {
+	s := endgame(t)
+	do(t, s, state.Roll(2)) // player 0 has a drop decision
+	d, err := Cautious{}.Decide(s, nil)
+	require.NoError(t, err)
+	assert.Equal(t, state.Drop(0, false), d)
+
+	// Divers with no treasure keep going, and divers low on air turn back.
+	sn := state.Snap(state.NewStandardState(2))
+	sn.Stage = state.StageTurn
+	sn.Players[0].Position = 10
+	d, err = Cautious{}.Decide(state.NewStandardStateFrom(sn), nil)
+	require.NoError(t, err)
+	assert.Equal(t, state.Turn(false), d)
+
+	sn.Players[0].HeldTreasure = []state.TreasureStack{
+		{{Type: state.TreasureTypeOne, Value: 0}}}
+	d, err = Cautious{}.Decide(state.NewStandardStateFrom(sn), nil)
+	require.NoError(t, err)
+	assert.Equal(t, state.Turn(false), d)
+
+	sn.Air = 3
+	d, err = Cautious{}.Decide(state.NewStandardStateFrom(sn), nil)
+	require.NoError(t, err)
+	assert.Equal(t, state.Turn(true), d)
+}
+
+// TestEstimatePolicy checks that cautious players do better than players
+// making random decisions.
+func TestEstimatePolicy(t *testing.T) {
+	s := state.NewStandardState(4)
+	opts := EstimateOptions{Iterations: 1000, LastRound: 2, Seed: 1}
+
+	uniform, err := Estimate(s, 0, opts)
+	require.NoError(t, err)
+
+	opts.Policy = Cautious{}
+	cautious, err := Estimate(s, 0, opts)
+	require.NoError(t, err)
+
+	assert.True(t, cautious.Mean > uniform.Mean)
+}
@@ -0,0 +1,42 @@
+package eval
+
+import (
+	"math/rand"
+)
+
+// splitMix is a rand.Source implementing SplitMix64. Unlike the default
+// source it's cheap to create, so every random game can have its own source,
+// which keeps results independent of how games are split between workers.
+type splitMix uint64
+
+func (sm *splitMix) Seed(seed int64) {
+	*sm = splitMix(seed)
+}
+
+func (sm *splitMix) Uint64() uint64 {
+	*sm += 0x9e3779b97f4a7c15
+	return mix64(uint64(*sm))
+}
+
+func (sm *splitMix) Int63() int64 {
+	return int64(sm.Uint64() >> 1)
+}
+
+// mix64 is the SplitMix64 finaliser, which scrambles the bits of its input.
+func mix64(z uint64) uint64 {
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// newRand returns the random number generator for the i'th random game of a
+// computation with the given seed.
+func newRand(seed int64, i int) *rand.Rand {
+	sm := splitMix(mix64(uint64(seed) ^ mix64(uint64(i)+1)))
+	return rand.New(&sm)
+}
+
+// newSeed returns a random seed for computations that weren't given one.
+func newSeed() int64 {
+	return rand.Int63()
+}
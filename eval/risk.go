@@ -0,0 +1,258 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+)
+
+// Risk is a criterion for ranking decisions by the distribution of the
+// utility that follows them, for players who care about more than its
+// expectation. A leader late in the game might prefer a safe decision to one
+// with a slightly better expectation, for instance, while a trailing player
+// might prefer a gamble.
+type Risk interface {
+	// Value returns the value of a decision with the given distribution
+	// of utility, where higher is better.
+	Value(e Estimation) float64
+}
+
+// MeanStdDev values distributions by their mean less Lambda standard
+// deviations. Positive values of Lambda are risk-averse, negative values are
+// risk-seeking, and zero is just the expectation.
+type MeanStdDev struct {
+	Lambda float64
+}
+
+func (r MeanStdDev) Value(e Estimation) float64 {
+	return e.Mean - r.Lambda*e.StdDev()
+}
+
+// Quantile values distributions by their Q-quantile, so that small values of
+// Q are pessimistic and large values optimistic.
+type Quantile struct {
+	Q float64
+}
+
+func (r Quantile) Value(e Estimation) float64 {
+	return e.Quantile(r.Q)
+}
+
+// Exceed values distributions by the probability of the utility being at
+// least the target. Searches only track the mean and variance of utilities,
+// so this is a normal approximation. The AtLeast utility maximises the exact
+// probability of reaching a target instead, although its scores value chips by
+// the expected value of their type rather than their actual value.
+type Exceed struct {
+	Target float64
+}
+
+func (r Exceed) Value(e Estimation) float64 {
+	return e.ProbAtLeast(r.Target)
+}
+
+// EvaluateDistributions is like Evaluate, but returns the distribution of the
+// player's utility following each valid decision. The player makes decisions
+// according to the options' risk criterion, or maximises their expectation if
+// there isn't one, and the rest of the search is as described by Evaluate.
+//
+// Distributions are tracked by their mean and variance, which are propagated
+// exactly through chance nodes, and are estimated at leaves by evaluators
+// that implement DistributionEvaluator. Since risk criteria aren't
+// expectations, the search is never pruned or cached, and isn't split between
+// workers, so it's only practical to shallow depths. Best-reply searches
+// aren't supported.
+func EvaluateDistributions(s state.State, opts Options) (
+	map[state.Decision]Estimation, error) {
+
+	if opts.Depth <= 0 {
+		return nil, nil // we're done, at max depth
+	}
+
+	sr, err := newSearcher(context.Background(), s, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	sr.risk = opts.Risk
+	if sr.risk == nil {
+		sr.risk = MeanStdDev{}
+	}
+
+	switch opts.Mode {
+	case ModeParanoid:
+		sr.adversary = adversaryAll
+	case ModeMaxN:
+		sr.adversary = adversaryNone
+	default:
+		return nil, errors.New(
+			"risk-sensitive searches must be paranoid or max-n")
+	}
+
+	dm := make(map[state.Decision]Estimation)
+	for _, vd := range s.ValidDecisions() {
+		if err := s.Do(vd); err != nil {
+			return nil, err
+		}
+
+		m, err := sr.moments(s, opts.Depth-1)
+		if err := s.Undo(); err != nil {
+			return nil, err
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		dm[vd] = estimationOf(m, sr.player)
+	}
+
+	return dm, nil
+}
+
+// evaluateRisk returns a map of the valid decisions in the given state to
+// their value by the options' risk criterion.
+func evaluateRisk(s state.State, opts Options) (
+	map[state.Decision]float64, error) {
+
+	edm, err := EvaluateDistributions(s, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if edm == nil {
+		return nil, nil
+	}
+
+	dm := make(map[state.Decision]float64)
+	for d, e := range edm {
+		dm[d] = opts.Risk.Value(e)
+	}
+
+	return dm, nil
+}
+
+// moments returns the first two moments of each player's utility in the given
+// state, which are their expected utilities followed by their expected
+// squared utilities. Both are linear in the probabilities of outcomes, so
+// they can be combined at chance nodes like expected utilities.
+func (sr *searcher) moments(s state.State, depth int) ([]float64, error) {
+	if err := sr.check(); err != nil {
+		return nil, err
+	}
+
+	sr.stats.Nodes++
+	if sr.isLeaf(s, depth) {
+		return sr.leafMoments(s)
+	}
+
+	if sr.modelled(s) {
+		return sr.expectation(s, func() ([]float64, error) {
+			return sr.moments(s, depth-1)
+		})
+	}
+
+	cp := s.CurrentPlayer()
+	adversarial := cp != sr.player &&
+		(sr.adversary == adversaryAll || sr.adversary == cp)
+
+	var res []float64
+	var best float64
+	for _, vd := range s.ValidDecisions() {
+		if err := s.Do(vd); err != nil {
+			return nil, err
+		}
+
+		m, err := sr.moments(s, depth-1)
+		if err := s.Undo(); err != nil {
+			return nil, err
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Rolls are chance nodes, and otherwise the current player picks
+		// whichever decision is best for them. Only the player is risk
+		// sensitive, and everyone else cares about expectations.
+		if s.Stage() == state.StageRoll {
+			if res == nil {
+				res = make([]float64, len(m))
+			}
+			for i := range res {
+				res[i] += rollProbability(vd) * m[i]
+			}
+
+			continue
+		}
+
+		var v float64
+		switch {
+		case adversarial:
+			v = -m[sr.player]
+		case cp == sr.player:
+			v = sr.risk.Value(estimationOf(m, cp))
+		default:
+			v = m[cp]
+		}
+		if res == nil || v > best {
+			res, best = m, v
+		}
+	}
+
+	return res, nil
+}
+
+// leafMoments returns the moments of each player's utility at a state at
+// which the search stops.
+func (sr *searcher) leafMoments(s state.State) ([]float64, error) {
+	sr.stats.Leaves++
+	if s.Round() >= sr.lastRound || s.Stage() == state.StageEndOfGame {
+		return certain(sr.utility.Utilities(s)), nil
+	}
+	sr.truncated = true
+
+	de, ok := sr.leafEval.(DistributionEvaluator)
+	if !ok {
+		ul, err := sr.leafEval.Evaluate(sr.leafOf(s))
+		if err != nil {
+			return nil, err
+		}
+
+		return certain(ul), nil
+	}
+
+	el, err := de.Distribution(sr.leafOf(s))
+	if err != nil {
+		return nil, err
+	}
+
+	m := make([]float64, 2*len(el))
+	for i, e := range el {
+		m[i] = e.Mean
+		m[len(el)+i] = e.Variance + e.Mean*e.Mean
+	}
+
+	return m, nil
+}
+
+// certain returns the moments of the given utilities, as if they were known
+// for certain.
+func certain(ul []float64) []float64 {
+	m := make([]float64, 2*len(ul))
+	for i, u := range ul {
+		m[i] = u
+		m[len(ul)+i] = u * u
+	}
+
+	return m
+}
+
+// estimationOf returns the distribution of the given player's utility with
+// the given moments.
+func estimationOf(m []float64, player int) Estimation {
+	mean := m[player]
+	variance := m[len(m)/2+player] - mean*mean
+
+	return Estimation{Mean: mean, Variance: math.Max(0, variance)}
+}
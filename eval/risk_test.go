@@ -0,0 +1,125 @@
+package eval
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEvaluateDistributionsNeutral checks that the means of distributions
+// are the values of Evaluate when the player is risk neutral.
+func TestEvaluateDistributionsNeutral(t *testing.T) {
+	s := state.NewStandardState(2)
+	do(t, s, state.Roll(3))
+
+	for _, mode := range []Mode{ModeParanoid, ModeMaxN} {
+		opts := Options{
+			Depth:         4,
+			Mode:          mode,
+			Leaf:          Heuristic{},
+			DisableSolver: true,
+		}
+		dm, err := Evaluate(s, opts)
+		require.NoError(t, err)
+		edm, err := EvaluateDistributions(s, opts)
+		require.NoError(t, err)
+
+		require.Len(t, edm, len(dm))
+		for d, e := range edm {
+			assert.InDelta(t, dm[d], e.Mean, 1e-9, "mode %d, %s", mode, d)
+		}
+	}
+}
+
+// risky returns a single-diver position in which the diver has to decide
+// whether to head back with some treasure or go deeper for more, with little
+// air left either way.
+func risky() state.State {
+	tiles := []state.Tile{{Type: state.TileTypeSubmarine}}
+	for _, tt := range state.TreasureTypes() {
+		tiles = append(tiles, state.Tile{
+			Type:     state.TileTypeTreasure,
+			Treasure: &state.TreasureStack{{Type: tt}},
+		})
+	}
+
+	return state.NewStandardStateFrom(state.Snapshot{
+		Round: 3,
+		Stage: state.StageTurn,
+		Air:   4,
+		Players: []state.Player{{
+			Position:     2,
+			HeldTreasure: []state.TreasureStack{{{Type: state.TreasureTypeTwo}}},
+		}},
+		Tiles: tiles,
+	})
+}
+
+// TestEvaluateDistributionsExact checks that variances searched to the end of
+// the round are exact, by comparing them with random games played by the
+// optimal policy for the diver.
+func TestEvaluateDistributionsExact(t *testing.T) {
+	s := risky()
+	edm, err := EvaluateDistributions(s, Options{Depth: completeDepth})
+	require.NoError(t, err)
+
+	sol, err := Solve(s, SolveOptions{})
+	require.NoError(t, err)
+	lastRound := s.Round() + 1
+	for d, e := range edm {
+		require.NoError(t, s.Do(d))
+		est, err := Estimate(s, 0, EstimateOptions{
+			Iterations: 4000,
+			LastRound:  lastRound,
+			Policy:     sol,
+			Seed:       1,
+		})
+		require.NoError(t, s.Undo())
+		require.NoError(t, err)
+
+		assert.InDelta(t, est.Mean, e.Mean, 3*est.StdErr, "%s", d)
+		assert.InEpsilon(t, est.Variance, e.Variance, 0.1, "%s", d)
+	}
+}
+
+// TestEvaluateRisk checks that risk-averse players give up expected score to
+// reduce their risk.
+func TestEvaluateRisk(t *testing.T) {
+	s := risky()
+	opts := Options{Depth: completeDepth}
+	neutral, err := EvaluateDistributions(s, opts)
+	require.NoError(t, err)
+
+	for _, risk := range []Risk{MeanStdDev{1}, MeanStdDev{-1}, Quantile{0.2},
+		Exceed{20}} {
+
+		opts.Risk = risk
+		edm, err := EvaluateDistributions(s, opts)
+		require.NoError(t, err)
+		dm, err := Evaluate(s, opts)
+		require.NoError(t, err)
+
+		require.Len(t, dm, len(neutral))
+		for d, e := range edm {
+			assert.Equal(t, risk.Value(e), dm[d])
+			assert.True(t, e.Mean <= neutral[d].Mean+1e-9, "%#v, %s", risk, d)
+		}
+	}
+
+	// Going deeper is better on average, but a risk-averse diver would
+	// rather head back with what they have.
+	assert.True(t,
+		neutral[state.Turn(false)].Mean > neutral[state.Turn(true)].Mean)
+	dm, err := Evaluate(s, Options{Depth: completeDepth, Risk: MeanStdDev{1}})
+	require.NoError(t, err)
+	assert.True(t, dm[state.Turn(true)] > dm[state.Turn(false)])
+
+	_, _, err = EvaluateContext(context.Background(), s, opts)
+	assert.Error(t, err)
+	_, err = Evaluate(s, Options{Depth: 1, Mode: ModeBestReply,
+		Risk: opts.Risk})
+	assert.Error(t, err)
+}
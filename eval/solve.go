@@ -0,0 +1,188 @@
+package eval
+
+import (
+	"errors"
+	"math/rand"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+)
+
+// Default maximum number of states Solve may visit.
+const defaultSolveStates = 1 << 18
+
+// Maximum number of states searches may visit when solving a leaf. Leaves
+// that turn out to be too big are estimated instead, so this is kept small
+// enough that giving up is cheap.
+const leafSolveStates = 2000
+
+// errStateLimit is returned by solves that exceed their state limit.
+var errStateLimit = errors.New("solver state limit exceeded")
+
+// SolveOptions configures Solve.
+type SolveOptions struct {
+	// Utility is what the diver maximises the expectation of, by default
+	// ExpectedScore.
+	Utility Utility
+
+	// MaxStates is the maximum number of distinct states to solve, or
+	// defaultSolveStates if it isn't positive.
+	MaxStates int
+}
+
+// Solvable returns the diver of a single-diver position, which is one where
+// every other player has already returned to the submarine, and true if the
+// given state is one. The rest of the round is then a one-player stochastic
+// control problem, which Solve can solve exactly.
+func Solvable(s state.State) (int, bool) {
+	if s.Stage() == state.StageEndOfGame {
+		return 0, false
+	}
+
+	for i, p := range s.Players() {
+		if i != s.CurrentPlayer() && !p.Done() {
+			return 0, false
+		}
+	}
+
+	return s.CurrentPlayer(), true
+}
+
+// Solution is the exact solution of a single-diver position. It's also a
+// policy for the diver, which makes the optimal decision in any position
+// reachable from the solved one, solving new positions if needed. Solutions
+// aren't safe for concurrent use.
+type Solution struct {
+	Diver  int       // player at sea
+	Values []float64 // expected utility of each player under optimal play
+
+	solver *solver
+}
+
+// Solve returns the exact solution of the given single-diver position to the
+// end of the round, in which the diver makes whichever decisions maximise
+// their expected utility. The values of states are memoised, so that each
+// distinct state is only solved once. An error is returned if the position
+// isn't a single-diver one, or has too many states.
+func Solve(s state.State, opts SolveOptions) (*Solution, error) {
+	diver, ok := Solvable(s)
+	if !ok {
+		return nil, errors.New("not a single-diver position")
+	}
+
+	sv := newSolver(s, opts)
+	v, err := sv.solve(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Solution{Diver: diver, Values: v.mean, solver: sv}, nil
+}
+
+// Decide returns the diver's optimal decision in the given state.
+func (sol *Solution) Decide(s state.State, rng *rand.Rand) (
+	state.Decision, error) {
+
+	if s.Round() != sol.solver.round {
+		return 0, errors.New("position isn't in the solved round")
+	}
+
+	v, err := sol.solver.solve(s)
+	if err != nil {
+		return 0, err
+	}
+
+	return v.best, nil
+}
+
+// solver solves the rest of a round by dynamic programming, assuming that
+// every player maximises their own utility. This is a single-diver control
+// problem for Solve, but the tablebase generator solves positions with more
+// players at sea.
+type solver struct {
+	round     int
+	maxStates int
+	utility   Utility
+	memo      map[state.Key]solved
+
+	// visit, if non-nil, is called with every state that's solved.
+	visit func(s state.State, v solved)
+}
+
+// solved is the solution of a single state.
+type solved struct {
+	mean []float64      // expected utility of each player
+	best state.Decision // optimal decision, if the player has a choice
+}
+
+func newSolver(s state.State, opts SolveOptions) *solver {
+	maxStates := opts.MaxStates
+	if maxStates <= 0 {
+		maxStates = defaultSolveStates
+	}
+
+	utility := opts.Utility
+	if utility == nil {
+		utility = ExpectedScore{}
+	}
+
+	return &solver{
+		round:     s.Round(),
+		maxStates: maxStates,
+		utility:   utility,
+		memo:      make(map[state.Key]solved),
+	}
+}
+
+// solve returns the solution of the given state, which must be in the
+// solver's round. The state is restored before returning.
+func (sv *solver) solve(s state.State) (solved, error) {
+	if s.Round() != sv.round || s.Stage() == state.StageEndOfGame {
+		return solved{mean: sv.utility.Utilities(s)}, nil
+	}
+
+	key := state.Canonical(s, 0)
+	if v, ok := sv.memo[key]; ok {
+		return v, nil
+	}
+	if len(sv.memo) >= sv.maxStates {
+		return solved{}, errStateLimit
+	}
+
+	var res solved
+	cp := s.CurrentPlayer()
+	for _, vd := range s.ValidDecisions() {
+		if err := s.Do(vd); err != nil {
+			return solved{}, err
+		}
+
+		v, err := sv.solve(s)
+		if err := s.Undo(); err != nil {
+			return solved{}, err
+		}
+		if err != nil {
+			return solved{}, err
+		}
+
+		// Rolls are chance nodes, and otherwise the current player picks
+		// whichever decision is best for them.
+		switch {
+		case s.Stage() == state.StageRoll:
+			if res.mean == nil {
+				res.mean = make([]float64, len(v.mean))
+			}
+			for i := range res.mean {
+				res.mean[i] += rollProbability(vd) * v.mean[i]
+			}
+
+		case res.mean == nil || v.mean[cp] > res.mean[cp]:
+			res = solved{mean: v.mean, best: vd}
+		}
+	}
+
+	sv.memo[key] = res
+	if sv.visit != nil {
+		sv.visit(s, res)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,151 @@
+package eval
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// diver returns the endgame after player 0 has returned to the submarine,
+// leaving player 1 alone at sea.
+func diver(t *testing.T) state.State {
+	s := endgame(t)
+	do(t, s, state.Roll(3))
+
+	return s
+}
+
+func TestSolvable(t *testing.T) {
+	_, ok := Solvable(state.NewStandardState(2))
+	assert.False(t, ok)
+	_, ok = Solvable(endgame(t))
+	assert.False(t, ok)
+
+	d, ok := Solvable(diver(t))
+	assert.True(t, ok)
+	assert.Equal(t, 1, d)
+
+	_, err := Solve(endgame(t), SolveOptions{})
+	assert.Error(t, err)
+}
+
+// TestSolve checks the solver against a brute force search of the rest of the
+// round, which is feasible because only one player makes decisions.
+func TestSolve(t *testing.T) {
+	s := diver(t)
+	key := state.Canonical(s, 0)
+
+	sol, err := Solve(s, SolveOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, key, state.Canonical(s, 0))
+	assert.Equal(t, 1, sol.Diver)
+	assert.InDeltaSlice(t, bruteForce(t, s, 1, adversaryNone, s.Round()),
+		sol.Values, 1e-9)
+
+	// Positions with the diver heading out are much bigger.
+	s = state.NewStandardState(2)
+	do(t, s,
+		state.Roll(2), state.PickUp(false), // player 0 to tile 2
+		state.Roll(3), state.PickUp(false), // player 1 to tile 3
+		state.Turn(true), state.Roll(2), // player 0 back to the submarine
+	)
+	_, err = Solve(s, SolveOptions{MaxStates: 1000})
+	assert.Equal(t, errStateLimit, err)
+}
+
+// TestSolutionPolicy checks that playing a solution's decisions achieves its
+// value, which also makes it ground truth for Estimate.
+func TestSolutionPolicy(t *testing.T) {
+	s := diver(t)
+	sol, err := Solve(s, SolveOptions{})
+	require.NoError(t, err)
+
+	est, err := Estimate(s, 1, EstimateOptions{
+		Iterations: 4000,
+		LastRound:  s.Round() + 1,
+		Policy:     sol,
+		Seed:       1,
+	})
+	require.NoError(t, err)
+
+	lo, hi := est.Interval()
+	assert.True(t, lo <= sol.Values[1] && sol.Values[1] <= hi,
+		"%v not in [%v, %v]", sol.Values[1], lo, hi)
+}
+
+// TestEvaluateSolver checks that single-diver leaves are solved exactly, so
+// that even a shallow search is exact.
+func TestEvaluateSolver(t *testing.T) {
+	s := diver(t)
+	exp, err := Evaluate(s, Options{Depth: 1000, DisableSolver: true})
+	require.NoError(t, err)
+
+	var stats Stats
+	dm, err := Evaluate(s, Options{Depth: 1, Stats: &stats, Leaf: new(constant)})
+	require.NoError(t, err)
+	assert.True(t, stats.Solves > 0)
+
+	require.Len(t, dm, len(exp))
+	for d, eval := range exp {
+		assert.InDelta(t, eval, dm[d], 1e-9, "decision %s", d)
+	}
+}
+
+// TestLeafSolverAdversary checks that single-diver leaves are only solved if
+// the diver maximises their own utility, since the solution assumes they do.
+// Here the diver's best line for their own rank isn't the one that's worst
+// for player 0's rank.
+func TestLeafSolverAdversary(t *testing.T) {
+	s := state.NewStandardState(3)
+	do(t, s,
+		state.Roll(3), state.PickUp(false), state.Roll(3), state.PickUp(true),
+		state.Roll(5), state.PickUp(false), state.Turn(true), state.Roll(4),
+		state.Turn(false), state.Roll(3), state.PickUp(true), state.Turn(false),
+		state.Roll(5), state.PickUp(false), state.Turn(false), state.Roll(3),
+		state.PickUp(false), state.Turn(false), state.Roll(5),
+		state.PickUp(false), state.Turn(true), state.Roll(5),
+		state.Drop(0, true), state.Turn(true), state.Roll(4), state.PickUp(true),
+		state.Roll(5), state.Roll(4), state.PickUp(false), state.Roll(2),
+		state.PickUp(true), state.Roll(2), state.Drop(0, true), state.Roll(2),
+		state.PickUp(false), state.Roll(4), state.PickUp(true), state.Roll(2),
+		state.Drop(0, true), state.Roll(2),
+	)
+	diver, ok := Solvable(s)
+	require.True(t, ok)
+	require.NotEqual(t, 0, diver)
+
+	for _, adversary := range []int{adversaryNone, adversaryAll} {
+		leaf := new(constant)
+		sr := searcher{
+			player:      0,
+			adversary:   adversary,
+			lastRound:   s.Round() + 1,
+			solveStates: leafSolveStates,
+			utility:     Rank{},
+			leafEval:    leaf,
+			stats:       new(Stats),
+			ctx:         context.Background(),
+		}
+
+		v, err := sr.value(s, 0)
+		require.NoError(t, err)
+		exp := bruteForceUtility(t, s, Rank{}, 0, adversary, s.Round())
+		if adversary == adversaryNone {
+			assert.Equal(t, 1, sr.stats.Solves)
+			assert.InDeltaSlice(t, exp, v, 1e-9)
+			continue
+		}
+
+		// The max-n solution overestimates player 0's paranoid value, so
+		// the leaf evaluator is used instead.
+		sol, err := Solve(s, SolveOptions{Utility: Rank{}})
+		require.NoError(t, err)
+		assert.True(t, sol.Values[0] > exp[0]+1e-6)
+		assert.Equal(t, 0, sr.stats.Solves)
+		assert.Equal(t, 1, leaf.calls)
+		assert.True(t, sr.truncated)
+	}
+}
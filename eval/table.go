@@ -0,0 +1,255 @@
+package eval
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"reflect"
+	"sync"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+)
+
+// tableEquivalence returns the equivalence of states used for transposition
+// table keys with the given utility. Evaluations never depend on the order in
+// which chips were stashed, and only depend on the types of chips rather than
+// their values if the utility values chips by type.
+func tableEquivalence(u Utility) state.Equivalence {
+	eq := state.EquivalenceStashOrder
+	if valuesByType(u) {
+		eq |= state.EquivalenceTreasureType
+	}
+
+	return eq
+}
+
+// valuesByType returns whether the given utility values chips of the same type
+// the same, whatever their actual values are. Other utilities might depend on
+// anything.
+func valuesByType(u Utility) bool {
+	su, ok := u.(scoreUtility)
+	if !ok {
+		return false
+	}
+
+	for _, tt := range state.TreasureTypes() {
+		for _, v := range state.TreasureValues(tt) {
+			t := state.Treasure{Type: tt, Value: v}
+			if su.chipValue(t) != su.chipValue(state.Treasure{Type: tt}) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Depth stored for values of states that were searched all the way to the
+// end of the round, which are valid for searches of any depth.
+const completeDepth = math.MaxInt32
+
+// Table is a bounded-memory transposition table, which caches the values of
+// states visited by searches so that they don't need to be searched again
+// when reached through a different sequence of decisions. A table can be
+// shared between searches, including concurrent ones, and between search
+// modes, since the parameters of the search are part of each entry's key.
+// Leaf evaluators that are pointers are keyed by identity, so sharing one
+// between searches doesn't share their entries unless it's the same pointer.
+//
+// The table is made up of buckets of two entries. The first entry in each
+// bucket is only replaced by entries searched at least as deeply, and the
+// second is always replaced, so that deep results survive while recent ones
+// remain available.
+type Table struct {
+	mu      sync.Mutex
+	buckets [][2]entry
+}
+
+// bound is the kind of value stored in a table entry.
+type bound int
+
+const (
+	boundExact bound = iota + 1
+	boundLower       // the true value is at least the stored value
+	boundUpper       // the true value is at most the stored value
+)
+
+type entry struct {
+	hash  uint64
+	depth int // remaining depth of the search that computed the entry
+	bound bound
+
+	// value is the value of the state by player, or just the searching
+	// player's value for pruned searches.
+	value []float64
+}
+
+// usable returns true if the entry can be used in place of searching its state
+// with the given window.
+func (e entry) usable(alpha, beta float64) bool {
+	switch e.bound {
+	case boundLower:
+		return e.value[0] >= beta
+	case boundUpper:
+		return e.value[0] <= alpha
+	}
+
+	return true
+}
+
+// NewTable returns a transposition table that holds up to the given number
+// of entries.
+func NewTable(size int) *Table {
+	n := size / 2
+	if n < 1 {
+		n = 1
+	}
+
+	return &Table{buckets: make([][2]entry, n)}
+}
+
+// Clear removes every entry from the table.
+func (t *Table) Clear() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i := range t.buckets {
+		t.buckets[i] = [2]entry{}
+	}
+}
+
+// lookup returns the entry for the given hash, if any, which was searched to
+// at least the given depth.
+func (t *Table) lookup(hash uint64, depth int) (entry, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b := &t.buckets[hash%uint64(len(t.buckets))]
+	for _, e := range b {
+		if e.bound != 0 && e.hash == hash && e.depth >= depth {
+			return e, true
+		}
+	}
+
+	return entry{}, false
+}
+
+// store saves the given entry in the table, subject to the replacement
+// policy. The entry's value is copied.
+func (t *Table) store(e entry) {
+	e.value = append([]float64(nil), e.value...)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b := &t.buckets[e.hash%uint64(len(t.buckets))]
+	if b[0].bound == 0 || b[0].hash == e.hash || e.depth >= b[0].depth {
+		// The displaced entry gets a second chance in the other slot.
+		if b[0].bound != 0 && b[0].hash != e.hash {
+			b[1] = b[0]
+		}
+
+		b[0] = e
+		return
+	}
+
+	b[1] = e
+}
+
+// cached returns the value of the given state from the table if possible, and
+// otherwise computes it with the given search function and stores it. Values
+// of pruned searches are the player's value alone, with the same semantics as
+// alphabeta with respect to the window (alpha, beta).
+func (sr *searcher) cached(s state.State, depth int, pruned bool,
+	alpha, beta float64, search func() ([]float64, error)) ([]float64, error) {
+
+	if sr.table == nil {
+		return search()
+	}
+
+	key := sr.key(s, pruned)
+	if e, ok := sr.table.lookup(key, depth); ok && e.usable(alpha, beta) {
+		sr.stats.Hits++
+		if e.depth != completeDepth {
+			sr.truncated = true
+		}
+
+		return e.value, nil
+	}
+	sr.stats.Misses++
+
+	// Truncation of this state's search is tracked separately from the rest
+	// of the search, so that complete results can be reused at any depth.
+	truncated := sr.truncated
+	sr.truncated = false
+	v, err := search()
+	complete := !sr.truncated
+	sr.truncated = sr.truncated || truncated
+	if err != nil {
+		return nil, err
+	}
+
+	e := entry{hash: key, depth: depth, bound: boundExact, value: v}
+	if complete {
+		e.depth = completeDepth
+	}
+	if pruned && v[0] <= alpha {
+		e.bound = boundUpper
+	} else if pruned && v[0] >= beta {
+		e.bound = boundLower
+	}
+
+	sr.table.store(e)
+	return v, nil
+}
+
+// key returns the transposition table key of the given state for the search.
+// Pruned values are bounds on a single player's value, rather than vectors of
+// exact values, so they are kept separate.
+func (sr *searcher) key(s state.State, pruned bool) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(state.Canonical(s, tableEquivalence(sr.utility))))
+
+	var p, r int
+	if pruned {
+		p = 1
+	}
+	if sr.bestReply {
+		r = 1
+	}
+
+	var b [8]byte
+	for _, v := range []int{sr.player, sr.adversary, sr.lastRound, p, r} {
+		binary.LittleEndian.PutUint64(b[:], uint64(v))
+		h.Write(b[:])
+	}
+	binary.LittleEndian.PutUint64(b[:], sr.params)
+	h.Write(b[:])
+
+	return h.Sum64()
+}
+
+// searchParams returns a hash of the parameters of a search that values
+// depend on, other than those that vary between the searches of a single
+// call, which are mixed into each key separately.
+func searchParams(u Utility, opponents []Policy, leafEval LeafEvaluator,
+	solveStates int, tb *Tablebase) uint64 {
+
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%#v %#v %s %d %p", u, opponents, identity(leafEval),
+		solveStates, tb)
+
+	return h.Sum64()
+}
+
+// identity returns a description of the given value that only depends on its
+// identity if it's a pointer, since the contents of stateful values like leaf
+// evaluators that count their calls change while they're used.
+func identity(v interface{}) string {
+	if reflect.ValueOf(v).Kind() == reflect.Ptr {
+		return fmt.Sprintf("%T(%p)", v, v)
+	}
+
+	return fmt.Sprintf("%#v", v)
+}
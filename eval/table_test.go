@@ -0,0 +1,202 @@
+package eval
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableReplacement(t *testing.T) {
+	tab := NewTable(2) // a single bucket
+	tab.store(entry{hash: 1, depth: 5, bound: boundExact, value: []float64{1}})
+	tab.store(entry{hash: 2, depth: 3, bound: boundExact, value: []float64{2}})
+
+	// Shallower entries don't displace deeper ones.
+	tab.store(entry{hash: 3, depth: 1, bound: boundExact, value: []float64{3}})
+	_, ok := tab.lookup(1, 0)
+	assert.True(t, ok)
+	_, ok = tab.lookup(2, 0)
+	assert.False(t, ok)
+
+	// Deeper entries push the previous deepest into the other slot.
+	tab.store(entry{hash: 4, depth: 6, bound: boundExact, value: []float64{4}})
+	e, ok := tab.lookup(4, 6)
+	assert.True(t, ok)
+	assert.Equal(t, []float64{4}, e.value)
+	_, ok = tab.lookup(1, 5)
+	assert.True(t, ok)
+	_, ok = tab.lookup(3, 0)
+	assert.False(t, ok)
+
+	// Entries searched too shallowly aren't returned.
+	_, ok = tab.lookup(4, 7)
+	assert.False(t, ok)
+
+	tab.Clear()
+	_, ok = tab.lookup(4, 0)
+	assert.False(t, ok)
+}
+
+func TestEntryUsable(t *testing.T) {
+	exact := entry{bound: boundExact, value: []float64{5}}
+	lower := entry{bound: boundLower, value: []float64{5}}
+	upper := entry{bound: boundUpper, value: []float64{5}}
+
+	assert.True(t, exact.usable(6, 7))
+	assert.True(t, lower.usable(0, 5))
+	assert.False(t, lower.usable(0, 6))
+	assert.True(t, upper.usable(5, 10))
+	assert.False(t, upper.usable(4, 10))
+}
+
+// TestEvaluateTable checks that searches give the same results with a shared
+// transposition table as without, in every search mode.
+func TestEvaluateTable(t *testing.T) {
+	s := endgame(t)
+	require.NoError(t, s.Do(state.Roll(2))) // player 0 has a drop decision
+
+	tab := NewTable(1 << 16)
+	modes := []Mode{ModeParanoid, ModeMaxN, ModeBestReply}
+	for _, mode := range modes {
+		for _, disable := range []bool{false, true} {
+			opts := Options{Depth: 100, Mode: mode, DisablePruning: disable}
+			exp, err := Evaluate(s, opts)
+			require.NoError(t, err)
+
+			// Twice, so that the second search is answered by the table.
+			for i := 0; i < 2; i++ {
+				var stats Stats
+				opts.Table, opts.Stats = tab, &stats
+				dm, err := Evaluate(s, opts)
+				require.NoError(t, err)
+				assert.True(t, stats.Hits > 0)
+
+				require.Len(t, dm, len(exp))
+				for d, eval := range exp {
+					assert.InDelta(t, eval, dm[d], 1e-9,
+						"mode %d, decision %s", mode, d)
+				}
+			}
+		}
+	}
+}
+
+// TestTableScore checks that positions which only differ in the values of
+// same-type chips don't share entries when the utility depends on values.
+func TestTableScore(t *testing.T) {
+	s := endgame(t)
+	require.NoError(t, s.Do(state.Roll(2))) // player 0 has a drop decision
+
+	// Swap one of player 0's chips with a chip of the same type on the board.
+	sn := state.Snap(s)
+	swapped := false
+	for _, ts := range sn.Players[0].HeldTreasure {
+		for i := range ts {
+			for _, tl := range sn.Tiles {
+				if swapped || tl.Treasure == nil {
+					continue
+				}
+
+				for j := range *tl.Treasure {
+					a, b := &ts[i], &(*tl.Treasure)[j]
+					if !swapped && a.Type == b.Type && a.Value != b.Value {
+						a.Value, b.Value = b.Value, a.Value
+						swapped = true
+					}
+				}
+			}
+		}
+	}
+	require.True(t, swapped)
+	other := state.NewStandardStateFrom(sn)
+
+	opts := Options{Depth: 100, Utility: Score{}}
+	exp, err := Evaluate(other, opts)
+	require.NoError(t, err)
+	orig, err := Evaluate(s, opts)
+	require.NoError(t, err)
+	require.NotEqual(t, orig, exp)
+
+	opts.Table = NewTable(1 << 16)
+	_, err = Evaluate(s, opts)
+	require.NoError(t, err)
+	dm, err := Evaluate(other, opts)
+	require.NoError(t, err)
+
+	require.Len(t, dm, len(exp))
+	for d, eval := range exp {
+		assert.InDelta(t, eval, dm[d], 1e-9, "decision %s", d)
+	}
+}
+
+// TestEvaluateContextTable checks that complete results are reused by later
+// iterations of iterative deepening, without affecting when it stops.
+func TestEvaluateContextTable(t *testing.T) {
+	s := endgame(t)
+	require.NoError(t, s.Do(state.Roll(2))) // player 0 has a drop decision
+
+	var stats, tabStats Stats
+	exp, depth, err := EvaluateContext(context.Background(), s,
+		Options{Mode: ModeMaxN, Stats: &stats})
+	require.NoError(t, err)
+
+	dm, tabDepth, err := EvaluateContext(context.Background(), s,
+		Options{Mode: ModeMaxN, Stats: &tabStats, Table: NewTable(1 << 16)})
+	require.NoError(t, err)
+
+	assert.Equal(t, depth, tabDepth)
+	assert.True(t, tabStats.Nodes < stats.Nodes)
+	for d, eval := range exp {
+		assert.InDelta(t, eval, dm[d], 1e-9, "decision %s", d)
+	}
+}
+
+func TestTableKey(t *testing.T) {
+	s := endgame(t)
+	sr, err := newSearcher(context.Background(), s, Options{})
+	require.NoError(t, err)
+	key := sr.key(s, false)
+	assert.NotEqual(t, key, sr.key(s, true))
+
+	sr.lastRound++
+	assert.NotEqual(t, key, sr.key(s, false))
+	sr.lastRound--
+
+	sr.adversary = adversaryNone
+	assert.NotEqual(t, key, sr.key(s, false))
+
+	// Every option that values depend on is part of the key.
+	for _, opts := range []Options{
+		{Utility: Win{}},
+		{Leaf: Heuristic{}},
+		{DisableSolver: true},
+		{Tablebase: &Tablebase{}},
+		{Opponents: []Policy{nil, Uniform{}}},
+	} {
+		other, err := newSearcher(context.Background(), s, opts)
+		require.NoError(t, err)
+		assert.NotEqual(t, key, other.key(s, false), "options %+v", opts)
+	}
+}
+
+// TestTableLeaf checks that searches with different leaf evaluators don't
+// share values through a table.
+func TestTableLeaf(t *testing.T) {
+	s := state.NewStandardState(3)
+	opts := Options{Depth: 3, Mode: ModeMaxN, Leaf: new(constant)}
+	exp, err := Evaluate(s, opts)
+	require.NoError(t, err)
+
+	table := NewTable(1 << 16)
+	_, err = Evaluate(s, Options{Depth: 3, Mode: ModeMaxN, Leaf: Heuristic{},
+		Table: table})
+	require.NoError(t, err)
+
+	opts.Table = table
+	dm, err := Evaluate(s, opts)
+	require.NoError(t, err)
+	assert.Equal(t, exp, dm)
+}
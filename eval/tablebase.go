@@ -0,0 +1,381 @@
+package eval
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+)
+
+// Round that tablebase positions are normalised to. Values only cover the
+// rest of the round, so positions in earlier rounds are equivalent to ones in
+// the last.
+const tablebaseRound = 3
+
+// Maximum number of players at sea in tablebase positions, which is the
+// number of values stored for each of them.
+const tablebaseDivers = 2
+
+var tablebaseMagic = [4]byte{'D', 'S', 'A', 'T'}
+
+const tablebaseVersion = 1
+
+// Number of entries read from a tablebase file at a time.
+const tablebaseChunk = 1 << 16
+
+// TablebaseBounds bounds the positions in a tablebase.
+type TablebaseBounds struct {
+	Tiles  int // tiles on the board, not counting the submarine
+	Divers int // players at sea, at most two
+	Stacks int // stacks of treasure held by each diver
+	Air    int // air left
+}
+
+// Tablebase is a table of the exact values of small positions, for the rest
+// of their round, assuming every player maximises their expected score. It
+// only covers positions within its bounds, and can be used to end max-n
+// searches of ExpectedScore early (see Options).
+//
+// Positions are keyed by the treasure types of what's at sea, ignoring
+// players who have finished their round and everybody's stashed treasure,
+// which have no effect on the rest of the round. The value of a position is
+// how much each player at sea adds to their expected score by the end of it.
+type Tablebase struct {
+	bounds  TablebaseBounds
+	entries []tablebaseEntry // sorted by hash
+}
+
+type tablebaseEntry struct {
+	Hash  uint64
+	Gains [tablebaseDivers]float32 // by seat amongst the players at sea
+}
+
+type tablebaseHeader struct {
+	Magic   [4]byte
+	Version uint32
+	Tiles   uint32
+	Divers  uint32
+	Stacks  uint32
+	Air     uint32
+	Count   uint64
+}
+
+// GenerateTablebase returns a tablebase of every position within the given
+// bounds. Positions are enumerated at the start of a player's turn, for every
+// board of single chips up to the bound on tiles, and solved by dynamic
+// programming. Every position reached while solving them is stored too.
+func GenerateTablebase(b TablebaseBounds) (*Tablebase, error) {
+	if b.Tiles < 1 || b.Divers < 1 || b.Divers > tablebaseDivers ||
+		b.Stacks < 0 || b.Air < 1 {
+		return nil, fmt.Errorf("invalid tablebase bounds %+v", b)
+	}
+
+	gains := make(map[uint64][tablebaseDivers]float32)
+	sv := newSolver(state.NewStandardState(1), SolveOptions{
+		MaxStates: math.MaxInt32,
+	})
+	sv.round = tablebaseRound
+	sv.visit = func(s state.State, v solved) {
+		if key, seats, ok := tablebaseKey(s, b); ok {
+			var g [tablebaseDivers]float32
+			for i, seat := range seats {
+				stashed := sum(s.Players()[seat].StashedTreasure)
+				g[i] = float32(v.mean[seat] - stashed)
+			}
+
+			gains[key] = g
+		}
+	}
+
+	var err error
+	for n := 1; n <= b.Tiles && err == nil; n++ {
+		boards(n, func(tiles []state.Tile) {
+			for d := 1; d <= b.Divers && err == nil; d++ {
+				divers(tiles, d, b.Stacks, func(pl []state.Player) {
+					for air := 1; air <= b.Air && err == nil; air++ {
+						for cp := range pl {
+							if err = solveStart(sv, tiles, pl, air, cp); err != nil {
+								return
+							}
+						}
+					}
+				})
+			}
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tb := Tablebase{bounds: b}
+	for key, g := range gains {
+		tb.entries = append(tb.entries, tablebaseEntry{Hash: key, Gains: g})
+	}
+	sort.Slice(tb.entries, func(i, j int) bool {
+		return tb.entries[i].Hash < tb.entries[j].Hash
+	})
+
+	return &tb, nil
+}
+
+// solveStart solves the position at the start of the given player's turn.
+func solveStart(sv *solver, tiles []state.Tile, pl []state.Player,
+	air, cp int) error {
+
+	stage := state.StageRoll
+	if p := pl[cp]; p.Position > 0 && !p.TurnedAround {
+		stage = state.StageTurn
+	}
+
+	_, err := sv.solve(state.NewStandardStateFrom(state.Snapshot{
+		Round:         tablebaseRound,
+		Stage:         stage,
+		Air:           air,
+		CurrentPlayer: cp,
+		Players:       pl,
+		Tiles:         append([]state.Tile{{Type: state.TileTypeSubmarine}}, tiles...),
+	}))
+
+	return err
+}
+
+// boards calls the given function with every board of the given number of
+// tiles, each of which is either empty or holds a single chip.
+func boards(n int, f func(tiles []state.Tile)) {
+	tiles := make([]state.Tile, n)
+	var fill func(i int)
+	fill = func(i int) {
+		if i == n {
+			f(tiles)
+			return
+		}
+
+		tiles[i] = state.Tile{Type: state.TileTypeEmpty}
+		fill(i + 1)
+		for _, tt := range state.TreasureTypes() {
+			tiles[i] = state.Tile{
+				Type:     state.TileTypeTreasure,
+				Treasure: &state.TreasureStack{{Type: tt}},
+			}
+			fill(i + 1)
+		}
+	}
+
+	fill(0)
+}
+
+// divers calls the given function with every arrangement of the given number
+// of players at sea on the given board. Players either haven't left the
+// submarine yet, or are on distinct tiles holding up to the given number of
+// single-chip stacks.
+func divers(tiles []state.Tile, n, stacks int, f func(pl []state.Player)) {
+	var options []state.Player
+	options = append(options, state.Player{})
+	for pos := 1; pos <= len(tiles); pos++ {
+		for _, turned := range []bool{false, true} {
+			helds(stacks, func(held []state.TreasureStack) {
+				options = append(options, state.Player{
+					Position:     pos,
+					TurnedAround: turned,
+					HeldTreasure: held,
+				})
+			})
+		}
+	}
+
+	pl := make([]state.Player, n)
+	var place func(i int)
+	place = func(i int) {
+		if i == n {
+			f(pl)
+			return
+		}
+
+	next:
+		for _, p := range options {
+			for _, op := range pl[:i] {
+				if p.Position > 0 && p.Position == op.Position {
+					continue next
+				}
+			}
+
+			pl[i] = p
+			place(i + 1)
+		}
+	}
+
+	place(0)
+}
+
+// helds calls the given function with every sequence of up to the given
+// number of single-chip stacks.
+func helds(stacks int, f func(held []state.TreasureStack)) {
+	var fill func(held []state.TreasureStack)
+	fill = func(held []state.TreasureStack) {
+		f(append([]state.TreasureStack(nil), held...))
+		if len(held) == stacks {
+			return
+		}
+
+		for _, tt := range state.TreasureTypes() {
+			fill(append(held, state.TreasureStack{{Type: tt}}))
+		}
+	}
+
+	fill(nil)
+}
+
+// tablebaseKey returns the key of the given state in a tablebase with the
+// given bounds, along with the seats of the players at sea in order, or false
+// if the state is out of bounds.
+func tablebaseKey(s state.State, b TablebaseBounds) (uint64, []int, bool) {
+	if s.Stage() == state.StageEndOfGame || s.Air() > b.Air ||
+		len(s.Tiles())-1 > b.Tiles {
+		return 0, nil, false
+	}
+
+	sn := state.Snap(s)
+	var pl []state.Player
+	var seats []int
+	var cp int
+	for i, p := range sn.Players {
+		if p.Done() {
+			continue
+		}
+		if i == sn.CurrentPlayer {
+			cp = len(pl)
+		}
+
+		p.StashedTreasure = nil
+		pl = append(pl, p)
+		seats = append(seats, i)
+	}
+	if len(pl) > b.Divers {
+		return 0, nil, false
+	}
+
+	sn.Round, sn.CurrentPlayer, sn.Players = tablebaseRound, cp, pl
+	key := state.Canonical(state.NewStandardStateFrom(sn),
+		state.EquivalenceTreasureType)
+
+	return key.Hash(), seats, true
+}
+
+// Len returns the number of positions in the tablebase.
+func (tb *Tablebase) Len() int {
+	return len(tb.entries)
+}
+
+// Bounds returns the bounds the tablebase was generated with.
+func (tb *Tablebase) Bounds() TablebaseBounds {
+	return tb.bounds
+}
+
+// Probe returns the expected score of each player at the end of the round
+// in the given state, if it's in the tablebase.
+func (tb *Tablebase) Probe(s state.State) ([]float64, bool) {
+	key, seats, ok := tablebaseKey(s, tb.bounds)
+	if !ok {
+		return nil, false
+	}
+
+	i := sort.Search(len(tb.entries), func(i int) bool {
+		return tb.entries[i].Hash >= key
+	})
+	if i == len(tb.entries) || tb.entries[i].Hash != key {
+		return nil, false
+	}
+
+	ul := rawUtilities(s)
+	for j, seat := range seats {
+		ul[seat] += float64(tb.entries[i].Gains[j])
+	}
+
+	return ul, true
+}
+
+// WriteTo writes the tablebase to the given writer in its binary format,
+// which is a header with the bounds and number of entries followed by the
+// entries sorted by key, so that the file doubles as an index. Entries are
+// matched to positions by a 64-bit hash of their key alone, and aren't
+// verified, so a hash collision gives a position the wrong values.
+func (tb *Tablebase) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	h := tablebaseHeader{
+		Magic:   tablebaseMagic,
+		Version: tablebaseVersion,
+		Tiles:   uint32(tb.bounds.Tiles),
+		Divers:  uint32(tb.bounds.Divers),
+		Stacks:  uint32(tb.bounds.Stacks),
+		Air:     uint32(tb.bounds.Air),
+		Count:   uint64(len(tb.entries)),
+	}
+
+	if err := binary.Write(bw, binary.LittleEndian, h); err != nil {
+		return 0, err
+	}
+	if err := binary.Write(bw, binary.LittleEndian, tb.entries); err != nil {
+		return 0, err
+	}
+
+	n := int64(binary.Size(h) + binary.Size(tb.entries))
+	return n, bw.Flush()
+}
+
+// ReadTablebase reads a tablebase written by WriteTo. Entries are read in
+// chunks, so that a corrupt count of entries fails at the end of the file
+// rather than allocating more memory than there is data.
+func ReadTablebase(r io.Reader) (*Tablebase, error) {
+	br := bufio.NewReader(r)
+	var h tablebaseHeader
+	if err := binary.Read(br, binary.LittleEndian, &h); err != nil {
+		return nil, err
+	}
+	if h.Magic != tablebaseMagic {
+		return nil, errors.New("not a tablebase")
+	}
+	if h.Version != tablebaseVersion {
+		return nil, fmt.Errorf("unsupported tablebase version %d", h.Version)
+	}
+
+	tb := Tablebase{
+		bounds: TablebaseBounds{
+			Tiles:  int(h.Tiles),
+			Divers: int(h.Divers),
+			Stacks: int(h.Stacks),
+			Air:    int(h.Air),
+		},
+	}
+	for n := h.Count; n > 0; {
+		chunk := uint64(tablebaseChunk)
+		if n < chunk {
+			chunk = n
+		}
+
+		el := make([]tablebaseEntry, chunk)
+		if err := binary.Read(br, binary.LittleEndian, el); err != nil {
+			return nil, err
+		}
+		tb.entries = append(tb.entries, el...)
+		n -= chunk
+	}
+
+	return &tb, nil
+}
+
+// LoadTablebase reads the tablebase in the given file.
+func LoadTablebase(path string) (*Tablebase, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadTablebase(f)
+}
@@ -0,0 +1,127 @@
+package eval
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testBounds = TablebaseBounds{Tiles: 2, Divers: 2, Stacks: 1, Air: 3}
+
+// small returns a three player position in the first round that's within the
+// test bounds once player 0, who has already finished, is ignored.
+func small() state.State {
+	return state.NewStandardStateFrom(state.Snapshot{
+		Round:         1,
+		Stage:         state.StageTurn,
+		Air:           3,
+		CurrentPlayer: 1,
+		Players: []state.Player{
+			{
+				TurnedAround: true,
+				StashedTreasure: []state.TreasureStack{
+					{{Type: state.TreasureTypeTwo, Value: 5}},
+				},
+			},
+			{
+				Position: 1,
+				HeldTreasure: []state.TreasureStack{
+					{{Type: state.TreasureTypeThree, Value: 9}},
+				},
+			},
+			{},
+		},
+		Tiles: []state.Tile{
+			{Type: state.TileTypeSubmarine},
+			{Type: state.TileTypeEmpty},
+			{
+				Type: state.TileTypeTreasure,
+				Treasure: &state.TreasureStack{
+					{Type: state.TreasureTypeOne, Value: 2},
+				},
+			},
+		},
+	})
+}
+
+func TestTablebase(t *testing.T) {
+	tb, err := GenerateTablebase(testBounds)
+	require.NoError(t, err)
+	assert.True(t, tb.Len() > 0)
+
+	s := small()
+	ul, ok := tb.Probe(s)
+	require.True(t, ok)
+	assert.InDeltaSlice(t, bruteForce(t, s, 1, adversaryNone, s.Round()), ul,
+		1e-4)
+
+	// Positions outside of the bounds aren't in the tablebase.
+	_, ok = tb.Probe(endgame(t))
+	assert.False(t, ok)
+
+	_, err = GenerateTablebase(TablebaseBounds{Tiles: 1, Divers: 3, Air: 1})
+	assert.Error(t, err)
+}
+
+func TestTablebaseFile(t *testing.T) {
+	tb, err := GenerateTablebase(testBounds)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	n, err := tb.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, int64(buf.Len()), n)
+
+	read, err := ReadTablebase(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, tb.Bounds(), read.Bounds())
+	assert.Equal(t, tb.entries, read.entries)
+
+	_, err = ReadTablebase(bytes.NewReader([]byte("not a tablebase at all")))
+	assert.Error(t, err)
+
+	// Truncated files with huge counts are errors, rather than allocating
+	// space for all of the entries up front.
+	buf.Reset()
+	tb.entries = nil
+	_, err = tb.WriteTo(&buf)
+	require.NoError(t, err)
+	b := buf.Bytes()
+	binary.LittleEndian.PutUint64(b[len(b)-8:], math.MaxUint64)
+	_, err = ReadTablebase(bytes.NewReader(b))
+	assert.Error(t, err)
+}
+
+// TestEvaluateTablebase checks that probes give the same results as searching,
+// and only happen in the searches they're valid for.
+func TestEvaluateTablebase(t *testing.T) {
+	tb, err := GenerateTablebase(testBounds)
+	require.NoError(t, err)
+
+	s := small()
+	opts := Options{Depth: 100, Mode: ModeMaxN, DisableSolver: true}
+	exp, err := Evaluate(s, opts)
+	require.NoError(t, err)
+
+	var stats Stats
+	opts.Tablebase, opts.Stats = tb, &stats
+	dm, err := Evaluate(s, opts)
+	require.NoError(t, err)
+	assert.True(t, stats.Probes > 0)
+
+	require.Len(t, dm, len(exp))
+	for d, eval := range exp {
+		assert.InDelta(t, eval, dm[d], 1e-4, "decision %s", d)
+	}
+
+	stats = Stats{}
+	opts.Mode = ModeParanoid
+	_, err = Evaluate(s, opts)
+	require.NoError(t, err)
+	assert.Equal(t, 0, stats.Probes)
+}
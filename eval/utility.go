@@ -0,0 +1,340 @@
+package eval
+
+import (
+	"math"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+)
+
+// Utility measures how good a state is for each player, which is what the
+// evaluators try to maximise the expectation of.
+type Utility interface {
+	// Utilities returns the utility of each player in the given state.
+	Utilities(s state.State) []float64
+
+	// Bounds returns lower and upper bounds on the utility the given player
+	// can end up with in any state reachable from the given state.
+	Bounds(s state.State, player int) (float64, float64)
+}
+
+// The built-in utilities are all functions of the scores of each player,
+// where the score of a player is the total value of the chips they've
+// stashed. A player can never lose stashed chips, and at best can stash every
+// chip that hasn't been stashed by somebody else.
+type scoreUtility interface {
+	Utility
+
+	// chipValue returns the value of a chip in a score.
+	chipValue(t state.Treasure) float64
+
+	// ofScores returns the utility of each player given their scores.
+	ofScores(sl []float64) []float64
+
+	// ofBounds returns bounds on the utility of the given player given
+	// bounds on the score of each player.
+	ofBounds(bl []interval, player int) (float64, float64)
+}
+
+// ExpectedScore is the expected value of a player's score, given the types of
+// the chips they've stashed. This is the default utility, and only depends on
+// information that's available to every player.
+type ExpectedScore struct{}
+
+func (u ExpectedScore) Utilities(s state.State) []float64 {
+	return rawUtilities(s)
+}
+
+func (u ExpectedScore) Bounds(s state.State, player int) (float64, float64) {
+	return u.ofBounds(scoreBounds(s, u), player)
+}
+
+func (ExpectedScore) chipValue(t state.Treasure) float64 {
+	return expectedUtility[t.Type]
+}
+
+func (ExpectedScore) ofScores(sl []float64) []float64 {
+	return sl
+}
+
+func (ExpectedScore) ofBounds(bl []interval, player int) (float64, float64) {
+	return bl[player].lo, bl[player].hi
+}
+
+// Score is the actual value of a player's score, which depends on the hidden
+// values of the chips they've stashed.
+type Score struct{}
+
+func (u Score) Utilities(s state.State) []float64 {
+	return u.ofScores(scores(s, u))
+}
+
+func (u Score) Bounds(s state.State, player int) (float64, float64) {
+	return u.ofBounds(scoreBounds(s, u), player)
+}
+
+func (Score) chipValue(t state.Treasure) float64 {
+	return float64(t.Value)
+}
+
+func (Score) ofScores(sl []float64) []float64 {
+	return sl
+}
+
+func (Score) ofBounds(bl []interval, player int) (float64, float64) {
+	return bl[player].lo, bl[player].hi
+}
+
+// Margin is the difference between a player's expected score and the best
+// expected score of their opponents, which rewards beating the others rather
+// than accumulating treasure for its own sake.
+type Margin struct{}
+
+func (u Margin) Utilities(s state.State) []float64 {
+	return u.ofScores(scores(s, u))
+}
+
+func (u Margin) Bounds(s state.State, player int) (float64, float64) {
+	return u.ofBounds(scoreBounds(s, u), player)
+}
+
+func (Margin) chipValue(t state.Treasure) float64 {
+	return expectedUtility[t.Type]
+}
+
+func (Margin) ofScores(sl []float64) []float64 {
+	res := make([]float64, len(sl))
+	if len(sl) == 1 {
+		return res // nobody to beat
+	}
+
+	for i := range sl {
+		best := math.Inf(-1)
+		for j, score := range sl {
+			if j != i {
+				best = math.Max(best, score)
+			}
+		}
+
+		res[i] = sl[i] - best
+	}
+
+	return res
+}
+
+func (Margin) ofBounds(bl []interval, player int) (float64, float64) {
+	if len(bl) == 1 {
+		return 0, 0
+	}
+
+	oppLo, oppHi := math.Inf(-1), math.Inf(-1)
+	for i, b := range bl {
+		if i != player {
+			oppLo = math.Max(oppLo, b.lo)
+			oppHi = math.Max(oppHi, b.hi)
+		}
+	}
+
+	return bl[player].lo - oppHi, bl[player].hi - oppLo
+}
+
+// Win is 1 for the player with the highest expected score and 0 for everyone
+// else, with ties split evenly. Its expectation is the probability of winning.
+type Win struct{}
+
+func (u Win) Utilities(s state.State) []float64 {
+	return u.ofScores(scores(s, u))
+}
+
+func (u Win) Bounds(s state.State, player int) (float64, float64) {
+	return u.ofBounds(scoreBounds(s, u), player)
+}
+
+func (Win) chipValue(t state.Treasure) float64 {
+	return expectedUtility[t.Type]
+}
+
+func (Win) ofScores(sl []float64) []float64 {
+	res := make([]float64, len(sl))
+	for i := range sl {
+		better, equal := rank(sl, i)
+		if better == 0 {
+			res[i] = 1 / float64(equal+1)
+		}
+	}
+
+	return res
+}
+
+func (Win) ofBounds(bl []interval, player int) (float64, float64) {
+	oppLo, oppHi := math.Inf(-1), math.Inf(-1)
+	for i, b := range bl {
+		if i != player {
+			oppLo = math.Max(oppLo, b.lo)
+			oppHi = math.Max(oppHi, b.hi)
+		}
+	}
+
+	switch {
+	case bl[player].lo > oppHi:
+		return 1, 1 // nobody can catch up
+	case bl[player].hi < oppLo:
+		return 0, 0 // can't catch up with somebody
+	}
+
+	return 0, 1
+}
+
+// Rank is a payoff based on the position of a player's expected score amongst
+// everybody's, from 1 for the best down to 0 for the worst in even steps.
+// Tied players share the average payoff of their positions.
+type Rank struct{}
+
+func (u Rank) Utilities(s state.State) []float64 {
+	return u.ofScores(scores(s, u))
+}
+
+func (u Rank) Bounds(s state.State, player int) (float64, float64) {
+	return u.ofBounds(scoreBounds(s, u), player)
+}
+
+func (Rank) chipValue(t state.Treasure) float64 {
+	return expectedUtility[t.Type]
+}
+
+func (Rank) ofScores(sl []float64) []float64 {
+	if len(sl) == 1 {
+		return []float64{1}
+	}
+
+	res := make([]float64, len(sl))
+	for i := range sl {
+		better, equal := rank(sl, i)
+		pos := float64(better) + float64(equal)/2
+		res[i] = 1 - pos/float64(len(sl)-1)
+	}
+
+	return res
+}
+
+func (Rank) ofBounds(bl []interval, player int) (float64, float64) {
+	if len(bl) == 1 {
+		return 1, 1
+	}
+
+	return 0, 1
+}
+
+// AtLeast is 1 for players whose expected score is at least the target and 0
+// for everyone else. Its expectation is the probability of reaching the
+// target, which is what a player needing a particular score should maximise.
+type AtLeast struct {
+	Target float64
+}
+
+func (u AtLeast) Utilities(s state.State) []float64 {
+	return u.ofScores(scores(s, u))
+}
+
+func (u AtLeast) Bounds(s state.State, player int) (float64, float64) {
+	return u.ofBounds(scoreBounds(s, u), player)
+}
+
+func (AtLeast) chipValue(t state.Treasure) float64 {
+	return expectedUtility[t.Type]
+}
+
+func (u AtLeast) ofScores(sl []float64) []float64 {
+	res := make([]float64, len(sl))
+	for i, score := range sl {
+		if score >= u.Target {
+			res[i] = 1
+		}
+	}
+
+	return res
+}
+
+func (u AtLeast) ofBounds(bl []interval, player int) (float64, float64) {
+	switch {
+	case bl[player].lo >= u.Target:
+		return 1, 1 // already there
+	case bl[player].hi < u.Target:
+		return 0, 0 // not enough treasure left
+	}
+
+	return 0, 1
+}
+
+// rank returns the number of players with a better score than the given
+// player, and the number of other players with an equal score.
+func rank(sl []float64, player int) (int, int) {
+	var better, equal int
+	for j, score := range sl {
+		switch {
+		case j == player:
+		case score > sl[player]:
+			better++
+		case score == sl[player]:
+			equal++
+		}
+	}
+
+	return better, equal
+}
+
+// scores returns the score of each player in the given state, valuing chips
+// with the given utility.
+func scores(s state.State, u scoreUtility) []float64 {
+	res := make([]float64, len(s.Players()))
+	for i, p := range s.Players() {
+		res[i] = chipTotal(p.StashedTreasure, u)
+	}
+
+	return res
+}
+
+// interval is a closed interval of real numbers.
+type interval struct {
+	lo, hi float64
+}
+
+// scoreBounds returns bounds on the score each player can end up with in any
+// state reachable from the given state, valuing chips with the given utility.
+func scoreBounds(s state.State, u scoreUtility) []interval {
+	free := freeTotal(s, u)
+	res := make([]interval, len(s.Players()))
+	for i, score := range scores(s, u) {
+		res[i] = interval{lo: score, hi: score + free}
+	}
+
+	return res
+}
+
+// freeTotal returns the value of the treasure that hasn't been stashed yet,
+// which is on the board or held by divers, valuing chips with the given
+// utility. It's the most any player's score can still go up by.
+func freeTotal(s state.State, u scoreUtility) float64 {
+	var free float64
+	for _, t := range s.Tiles() {
+		if t.Treasure != nil {
+			free += chipTotal([]state.TreasureStack{*t.Treasure}, u)
+		}
+	}
+
+	for _, p := range s.Players() {
+		free += chipTotal(p.HeldTreasure, u)
+	}
+
+	return free
+}
+
+func chipTotal(tsl []state.TreasureStack, u scoreUtility) float64 {
+	var res float64
+	for _, ts := range tsl {
+		for _, t := range ts {
+			res += u.chipValue(t)
+		}
+	}
+
+	return res
+}
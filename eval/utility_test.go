@@ -0,0 +1,135 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBounds(t *testing.T) {
+	s := endgame(t)
+	lo, hi := ExpectedScore{}.Bounds(s, 0)
+	assert.Equal(t, 0.0, lo)
+	assert.Equal(t, 8*1.5+8*5.5+8*9.5+8*13.5, hi)
+
+	// Once both players are home, their stashed treasure can't be lost.
+	do(t, s, state.Roll(3), state.Roll(3))
+	require.Equal(t, 2, s.Round())
+	lo, hi = ExpectedScore{}.Bounds(s, 0)
+	assert.Equal(t, 3.0, lo)
+	assert.Equal(t, 8*1.5+8*5.5+8*9.5+8*13.5-1.5, hi)
+
+	// Actual scores use the values of the chips.
+	var total float64
+	for _, tt := range state.TreasureTypes() {
+		for _, v := range state.TreasureValues(tt) {
+			total += float64(v)
+		}
+	}
+	lo, hi = Score{}.Bounds(s, 0)
+	assert.Equal(t, Score{}.Utilities(s)[0], lo)
+	assert.Equal(t, total-Score{}.Utilities(s)[1], hi)
+}
+
+func TestOfScores(t *testing.T) {
+	sl := []float64{3, 7, 7, 1}
+	assert.Equal(t, sl, ExpectedScore{}.ofScores(sl))
+	assert.Equal(t, []float64{-4, 0, 0, -6}, Margin{}.ofScores(sl))
+	assert.Equal(t, []float64{0, 0.5, 0.5, 0}, Win{}.ofScores(sl))
+	assert.InDeltaSlice(t, []float64{1.0 / 3, 5.0 / 6, 5.0 / 6, 0},
+		Rank{}.ofScores(sl), 1e-9)
+	assert.Equal(t, []float64{0, 1, 1, 0}, AtLeast{Target: 7}.ofScores(sl))
+
+	// With nobody else to compete with, a player always wins.
+	assert.Equal(t, []float64{0}, Margin{}.ofScores([]float64{5}))
+	assert.Equal(t, []float64{1}, Win{}.ofScores([]float64{5}))
+	assert.Equal(t, []float64{1}, Rank{}.ofScores([]float64{5}))
+}
+
+// TestUtilityBounds plays random games, checking that the utilities at the
+// end of each are within the bounds of every state along the way.
+func TestUtilityBounds(t *testing.T) {
+	utilities := []Utility{ExpectedScore{}, Score{}, Margin{}, Win{}, Rank{},
+		AtLeast{Target: 20}}
+	s := state.NewStandardState(3)
+	rng := newRand(1, 0)
+
+	for i := 0; i < 20; i++ {
+		type bound struct{ lo, hi float64 }
+		var history [][][]bound
+		for s.Stage() != state.StageEndOfGame {
+			bl := make([][]bound, len(utilities))
+			for j, u := range utilities {
+				for p := range s.Players() {
+					lo, hi := u.Bounds(s, p)
+					bl[j] = append(bl[j], bound{lo, hi})
+				}
+			}
+			history = append(history, bl)
+
+			vdl := s.ValidDecisions()
+			require.NoError(t, s.Do(vdl[rng.Intn(len(vdl))]))
+		}
+
+		for j, u := range utilities {
+			ul := u.Utilities(s)
+			for _, bl := range history {
+				for p, b := range bl[j] {
+					assert.True(t, b.lo <= ul[p] && ul[p] <= b.hi,
+						"%T player %d: %v not in %v", u, p, ul[p], b)
+				}
+			}
+		}
+
+		for len(history) > 0 {
+			require.NoError(t, s.Undo())
+			history = history[1:]
+		}
+	}
+}
+
+// TestEvaluateUtility checks that the utility is used consistently by every
+// evaluator. In a two player endgame, the probability of winning is the same
+// whether it's searched, estimated or evaluated at the leaves.
+func TestEvaluateUtility(t *testing.T) {
+	s := endgame(t)
+	do(t, s, state.Roll(2)) // player 0 has a drop decision
+
+	maxn, err := Evaluate(s, Options{Depth: 100, Mode: ModeMaxN, Utility: Win{}})
+	require.NoError(t, err)
+	require.Len(t, maxn, 3)
+	for _, eval := range maxn {
+		assert.True(t, eval >= 0 && eval <= 1)
+	}
+
+	// Pruning relies on the bounds of the utility.
+	paranoid, err := Evaluate(s, Options{Depth: 100, Utility: Margin{}})
+	require.NoError(t, err)
+	full, err := Evaluate(s, Options{Depth: 100, Utility: Margin{},
+		DisablePruning: true})
+	require.NoError(t, err)
+	for d, eval := range full {
+		assert.InDelta(t, eval, paranoid[d], 1e-9)
+	}
+
+	exact, err := Evaluate(s, Options{Depth: 1, Mode: ModeMaxN,
+		Utility: Win{}, Leaf: Exact{}})
+	require.NoError(t, err)
+	for d, eval := range maxn {
+		assert.InDelta(t, eval, exact[d], 1e-9)
+	}
+
+	// Monte-carlo estimates are in the range of the utility too.
+	e, err := Estimate(s, 0, EstimateOptions{LastRound: s.Round() + 1,
+		Utility: Rank{}, Seed: 1})
+	require.NoError(t, err)
+	assert.True(t, e.Mean >= 0 && e.Mean <= 1)
+
+	dm, err := MCTS(s, MCTSOptions{Iterations: 500, Utility: Win{}, Seed: 1})
+	require.NoError(t, err)
+	for _, eval := range dm {
+		assert.True(t, eval >= 0 && eval <= 1)
+	}
+}
@@ -0,0 +1,189 @@
+package game
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/bubblyworld/deep-sea-adventure/eval"
+	"github.com/bubblyworld/deep-sea-adventure/state"
+)
+
+// Default number of pairs of games played by Exploit.
+const exploitGames = 100
+
+// Default depth of the best response's searches.
+const exploitDepth = 2
+
+// ExploitOptions configures Exploit.
+type ExploitOptions struct {
+	// Games is the number of pairs of games to play, by default
+	// exploitGames.
+	Games int
+
+	// Depth is the depth of the best response's searches, by default
+	// exploitDepth.
+	Depth int
+
+	// Utility is what the best response maximises the expectation of, and
+	// what the gain is measured in. By default it's ExpectedScore.
+	Utility eval.Utility
+
+	// Leaf evaluates the leaves of the best response's searches, using
+	// eval.Rollouts by default.
+	Leaf eval.LeafEvaluator
+
+	// Workers is the number of goroutines each search is split between.
+	Workers int
+
+	// Seed, if non-zero, seeds the dice and the searches so that the
+	// result is deterministic.
+	Seed int64
+}
+
+// Exploitation is a measure of how exploitable a seat's strategy is, given
+// the strategies of every other seat.
+type Exploitation struct {
+	Seat         int
+	Strategy     eval.Estimation // utility of the seat's own strategy
+	BestResponse eval.Estimation // utility of the best response
+	Gain         eval.Estimation // utility gained by the best response
+}
+
+// Exploit estimates how much the given seat could gain by deviating from its
+// strategy, if everybody else kept to theirs. The best response is played by
+// a max-n search that models the other seats with their strategies, which is
+// only an approximation of the true best response, so the gain is a lower
+// bound on the exploitability of the strategy (up to sampling error).
+//
+// Games are played in pairs with the same dice, one with the seat's own
+// strategy and one with the best response, and the gain is estimated from
+// the difference in the seat's utility over each pair. Positive gains mean
+// the strategy can be exploited.
+func Exploit(sl []Strategy, seat int, opts ExploitOptions) (
+	*Exploitation, error) {
+
+	if seat < 0 || seat >= len(sl) {
+		return nil, fmt.Errorf("invalid seat %d for %d players", seat, len(sl))
+	}
+
+	games := opts.Games
+	if games <= 0 {
+		games = exploitGames
+	}
+	depth := opts.Depth
+	if depth <= 0 {
+		depth = exploitDepth
+	}
+	utility := opts.Utility
+	if utility == nil {
+		utility = eval.ExpectedScore{}
+	}
+	seed := opts.Seed
+	if seed == 0 {
+		seed = rand.Int63()
+	}
+
+	opponents := make([]eval.Policy, len(sl))
+	for i := range opponents {
+		if i != seat {
+			opponents[i] = NewPolicy(sl[i])
+		}
+	}
+
+	search := eval.Options{
+		Depth:     depth,
+		Mode:      eval.ModeMaxN,
+		Opponents: opponents,
+		Utility:   opts.Utility,
+		Leaf:      opts.Leaf,
+		Workers:   opts.Workers,
+	}
+	response := func(s state.State, rng *rand.Rand) (state.Decision, error) {
+		vdl := s.ValidDecisions()
+		if len(vdl) == 1 {
+			return vdl[0], nil
+		}
+
+		search.Seed = rng.Int63()
+		dm, err := eval.Evaluate(s, search)
+		if err != nil {
+			return 0, err
+		}
+
+		best := vdl[0]
+		for _, vd := range vdl {
+			if dm[vd] > dm[best] {
+				best = vd
+			}
+		}
+
+		return best, nil
+	}
+
+	own, best, gains := make([]float64, games), make([]float64, games),
+		make([]float64, games)
+	for i := 0; i < games; i++ {
+		var err error
+		own[i], err = play(sl, seat, nil, utility, seed+int64(i))
+		if err != nil {
+			return nil, err
+		}
+		best[i], err = play(sl, seat, response, utility, seed+int64(i))
+		if err != nil {
+			return nil, err
+		}
+
+		gains[i] = best[i] - own[i]
+	}
+
+	return &Exploitation{
+		Seat:         seat,
+		Strategy:     eval.NewEstimation(own),
+		BestResponse: eval.NewEstimation(best),
+		Gain:         eval.NewEstimation(gains),
+	}, nil
+}
+
+// play plays a game with the given strategies and returns the seat's utility
+// at the end of it. If the given decider is non-nil, it makes the seat's
+// decisions in place of its strategy. The dice and each seat's decisions use
+// their own sources seeded by the given seed, so that games with the same
+// seed see the same rolls, and the same choices by the other seats for as
+// long as the game goes the same way.
+func play(sl []Strategy, seat int,
+	decide func(state.State, *rand.Rand) (state.Decision, error),
+	utility eval.Utility, seed int64) (float64, error) {
+
+	dice := rand.New(rand.NewSource(seed))
+	seeds := rand.New(rand.NewSource(^seed))
+	rngs := make([]*rand.Rand, len(sl))
+	for i := range rngs {
+		rngs[i] = rand.New(rand.NewSource(seeds.Int63()))
+	}
+	pl := NewPolicy(sl...)
+
+	s := state.NewStandardState(len(sl))
+	for s.Stage() != state.StageEndOfGame {
+		var d state.Decision
+		var err error
+		switch {
+		case s.Stage() == state.StageRoll:
+			d = state.Roll(2 + dice.Intn(3) + dice.Intn(3))
+
+		case s.CurrentPlayer() == seat && decide != nil:
+			d, err = decide(s, rngs[seat])
+
+		default:
+			d, err = pl.Decide(s, rngs[s.CurrentPlayer()])
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if err := s.Do(d); err != nil {
+			return 0, err
+		}
+	}
+
+	return utility.Utilities(s)[seat], nil
+}
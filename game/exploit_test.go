@@ -0,0 +1,60 @@
+package game
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/bubblyworld/deep-sea-adventure/eval"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestExploit checks that divers who never turn around are exploitable, as
+// they never make it back to the submarine with anything.
+func TestExploit(t *testing.T) {
+	sl := []Strategy{AlwaysDeeper{}, AlwaysDeeper{}}
+	ex, err := Exploit(sl, 1, ExploitOptions{
+		Games: 10,
+		Depth: 2,
+		Leaf:  eval.Heuristic{},
+		Seed:  1,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, ex.Seat)
+	assert.Equal(t, 10, ex.Gain.N)
+	assert.InDelta(t, ex.BestResponse.Mean-ex.Strategy.Mean, ex.Gain.Mean, 1e-9)
+	assert.True(t, ex.Gain.Mean > 0, "gain %v", ex.Gain.Mean)
+
+	_, err = Exploit(sl, 2, ExploitOptions{})
+	assert.Error(t, err)
+}
+
+// TestExploitWorkers checks that random strategies are modelled the same way
+// however many workers the best response's searches are split between.
+func TestExploitWorkers(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	sl := []Strategy{FromPolicy(eval.Uniform{}, rng),
+		FromPolicy(eval.Uniform{}, rng)}
+	opts := ExploitOptions{Games: 3, Depth: 2, Leaf: eval.Heuristic{}, Seed: 2}
+
+	a, err := Exploit(sl, 0, opts)
+	require.NoError(t, err)
+	opts.Workers = 4
+	b, err := Exploit(sl, 0, opts)
+	require.NoError(t, err)
+	assert.Equal(t, a, b)
+}
+
+// TestExploitDeterministic checks that seeded measurements are repeatable.
+func TestExploitDeterministic(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	sl := []Strategy{FromPolicy(eval.Cautious{}, rng), AlwaysDeeper{}}
+	opts := ExploitOptions{Games: 5, Depth: 1, Leaf: eval.Heuristic{}, Seed: 2}
+
+	a, err := Exploit(sl, 0, opts)
+	require.NoError(t, err)
+	b, err := Exploit(sl, 0, opts)
+	require.NoError(t, err)
+	assert.Equal(t, a, b)
+}
@@ -3,8 +3,13 @@
 package game
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math/rand"
+	"runtime"
+	"strings"
+	"time"
 
 	"github.com/bubblyworld/deep-sea-adventure/eval"
 	"github.com/bubblyworld/deep-sea-adventure/state"
@@ -28,16 +33,27 @@ type Strategy interface {
 	Drop(state.State) (int, bool)
 }
 
+// Default amount of time to spend evaluating each position.
+const defaultThinkTime = time.Second
+
+// Number of entries in the transposition table shared by evaluations.
+const tableSize = 1 << 18
+
 // Game drives a strategy-driven game of deep sea adventure.
 type Game struct {
 	State      state.State
-	Strategies []Strategy // strategy indexed by player
+	Strategies []Strategy    // strategy indexed by player
+	ThinkTime  time.Duration // time to spend evaluating each position
+	Dice       *rand.Rand    // source of dice rolls, or the global one if nil
+	table      *eval.Table
 }
 
 func New(sl []Strategy) *Game {
 	return &Game{
 		State:      state.NewStandardState(len(sl)),
 		Strategies: sl,
+		ThinkTime:  defaultThinkTime,
+		table:      eval.NewTable(tableSize),
 	}
 }
 
@@ -54,17 +70,25 @@ func (g *Game) Run() {
 	fmt.Printf("\tround %d, player %d to move (air before turn: %d)\n",
 		g.State.Round(), g.State.CurrentPlayer(), g.State.Air())
 
-	dm, err := eval.Evaluate(g.State, 6)
-	if err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), g.ThinkTime)
+	a, err := eval.Analyse(ctx, g.State,
+		eval.Options{Table: g.table, Workers: runtime.NumCPU()})
+	cancel()
+	if err != nil && err != ctx.Err() {
 		panic(fmt.Errorf("error evaluting position: %v", err))
 	}
-	for d, eval := range dm {
-		fmt.Printf("\t\t%20s: %.4f\n", d, eval)
+	if err != nil {
+		fmt.Printf("\tno evaluation within %s\n", g.ThinkTime)
+	} else {
+		fmt.Printf("\tevaluation:\n")
+		for _, line := range strings.Split(strings.TrimSpace(a.String()), "\n") {
+			fmt.Printf("\t\t%s\n", line)
+		}
 	}
 
 	switch g.State.Stage() {
 	case state.StageRoll:
-		roll := roll()
+		roll := g.roll()
 		fmt.Printf("\tplayer %d has rolled %d\n",
 			g.State.CurrentPlayer(), roll)
 
@@ -117,6 +141,28 @@ func (g *Game) Run() {
 	fmt.Printf("END\n\n")
 }
 
+// Step plays the next decision of the game, using the current player's
+// strategy if it isn't a roll. Unlike Run, it doesn't evaluate the position or
+// print anything, which makes it suitable for playing many games quickly.
+func (g *Game) Step() error {
+	if g.State.Stage() == state.StageEndOfGame {
+		return errors.New("game is over")
+	}
+
+	var d state.Decision
+	if g.State.Stage() == state.StageRoll {
+		d = state.Roll(g.roll())
+	} else {
+		var err error
+		st := g.Strategies[g.State.CurrentPlayer()]
+		if d, err = decide(st, g.State); err != nil {
+			return err
+		}
+	}
+
+	return g.State.Do(d)
+}
+
 func printState(s state.State) string {
 	pm := make(map[int]string)
 	for i, p := range s.Players() {
@@ -155,6 +201,10 @@ func printState(s state.State) string {
 	return str
 }
 
-func roll() int {
-	return 2 + rand.Intn(3) + rand.Intn(3)
+func (g *Game) roll() int {
+	if g.Dice == nil {
+		return 2 + rand.Intn(3) + rand.Intn(3)
+	}
+
+	return 2 + g.Dice.Intn(3) + g.Dice.Intn(3)
 }
@@ -0,0 +1,32 @@
+package game
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/bubblyworld/deep-sea-adventure/eval"
+	"github.com/bubblyworld/deep-sea-adventure/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStep(t *testing.T) {
+	play := func() state.Key {
+		g := &Game{
+			State: state.NewStandardState(3),
+			Strategies: []Strategy{AlwaysDeeper{}, greedy{},
+				FromPolicy(eval.Cautious{}, nil)},
+			Dice: rand.New(rand.NewSource(1)),
+		}
+		for g.State.Stage() != state.StageEndOfGame {
+			require.NoError(t, g.Step())
+		}
+		assert.Error(t, g.Step())
+
+		return state.Canonical(g.State, state.EquivalenceTreasureType)
+	}
+
+	// Games with the same dice play out the same way, although the values
+	// of the treasure on the board are shuffled differently.
+	assert.Equal(t, play(), play())
+}
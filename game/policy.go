@@ -0,0 +1,77 @@
+package game
+
+import (
+	"errors"
+	"math/rand"
+
+	"github.com/bubblyworld/deep-sea-adventure/eval"
+	"github.com/bubblyworld/deep-sea-adventure/state"
+)
+
+// NewPolicy returns a rollout policy that makes decisions using the given
+// strategies, so that they can be used as opponents in monte-carlo
+// estimation. Player i is played by strategy i modulo the number of
+// strategies, so a single strategy plays for everyone.
+//
+// Strategies returned by FromPolicy decide with their policy and the
+// randomness the rollout policy is given, rather than their own source. A
+// single one of them is returned as its policy, so that searches modelling it
+// take the probabilities of stochastic policies into account exactly.
+func NewPolicy(sl ...Strategy) eval.Policy {
+	if len(sl) == 1 {
+		if fp, ok := sl[0].(*fromPolicy); ok {
+			return fp.policy
+		}
+	}
+
+	return policy(sl)
+}
+
+type policy []Strategy
+
+func (pl policy) Decide(s state.State, rng *rand.Rand) (state.Decision, error) {
+	st := pl[s.CurrentPlayer()%len(pl)]
+	if fp, ok := st.(*fromPolicy); ok && s.Stage() != state.StageRoll {
+		return fp.policy.Decide(s, rng)
+	}
+
+	return decide(st, s)
+}
+
+// decide returns the decision the given strategy makes in the given state.
+func decide(st Strategy, s state.State) (state.Decision, error) {
+	switch s.Stage() {
+	case state.StagePickUp:
+		return state.PickUp(st.PickUp(s)), nil
+
+	case state.StageDrop:
+		// Invalid drops don't do anything, as documented by Strategy.
+		d := state.Drop(st.Drop(s))
+		if !isValid(s, d) {
+			d = state.Drop(0, false)
+		}
+
+		return d, nil
+
+	case state.StageTurn:
+		// Players at the end of the board have to turn around.
+		d := state.Turn(st.Turn(s))
+		if !isValid(s, d) {
+			d = state.Turn(true)
+		}
+
+		return d, nil
+	}
+
+	return 0, errors.New("strategies can only decide in choice stages")
+}
+
+func isValid(s state.State, d state.Decision) bool {
+	for _, vd := range s.ValidDecisions() {
+		if vd == d {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,80 @@
+package game
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/bubblyworld/deep-sea-adventure/eval"
+	"github.com/bubblyworld/deep-sea-adventure/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// greedy always goes deeper, picks everything up, and tries to drop treasure
+// that it doesn't have.
+type greedy struct{}
+
+func (greedy) Turn(state.State) bool        { return false }
+func (greedy) PickUp(state.State) bool      { return true }
+func (greedy) Drop(state.State) (int, bool) { return 100, true }
+
+func TestPolicy(t *testing.T) {
+	s := state.NewStandardState(3)
+	e, err := eval.Estimate(s, 0, eval.EstimateOptions{
+		Iterations: 100,
+		Policy:     NewPolicy(greedy{}),
+		Seed:       1,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 100, e.N)
+
+	_, err = NewPolicy(greedy{}).Decide(s, rand.New(rand.NewSource(1)))
+	assert.Error(t, err) // can't decide rolls
+}
+
+// TestPolicyRandomness checks that strategies backed by policies decide with
+// the randomness that the rollout policy is given.
+func TestPolicyRandomness(t *testing.T) {
+	s := state.NewStandardState(2)
+	require.NoError(t, s.Do(state.Roll(3)))
+
+	own := rand.New(rand.NewSource(1))
+	st := FromPolicy(eval.Uniform{}, own)
+	assert.Equal(t, eval.Uniform{}, NewPolicy(st))
+
+	pl := NewPolicy(st, AlwaysDeeper{}) // player 0 has a pick up decision
+
+	decide := func() []state.Decision {
+		rng := rand.New(rand.NewSource(2))
+		var dl []state.Decision
+		for i := 0; i < 20; i++ {
+			own.Int63() // the strategy's own source isn't used
+			d, err := pl.Decide(s, rng)
+			require.NoError(t, err)
+			dl = append(dl, d)
+		}
+
+		return dl
+	}
+	assert.Equal(t, decide(), decide())
+}
+
+// TestPolicyOpponent checks that strategies can be used as opponent models.
+// A known opponent can never be worse for the player than a paranoid one.
+func TestPolicyOpponent(t *testing.T) {
+	s := state.NewStandardState(2)
+	require.NoError(t, s.Do(state.Roll(3)))
+
+	opts := eval.Options{Depth: 4, Leaf: eval.Heuristic{}}
+	paranoid, err := eval.Evaluate(s, opts)
+	require.NoError(t, err)
+
+	opts.Opponents = []eval.Policy{nil, NewPolicy(greedy{})}
+	modelled, err := eval.Evaluate(s, opts)
+	require.NoError(t, err)
+
+	require.Len(t, modelled, len(paranoid))
+	for d, eval := range paranoid {
+		assert.True(t, eval <= modelled[d]+1e-9, "decision %s", d)
+	}
+}
@@ -0,0 +1,82 @@
+package game
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/bubblyworld/deep-sea-adventure/eval"
+	"github.com/bubblyworld/deep-sea-adventure/state"
+)
+
+// AlwaysDeeper never turns around, picks up every treasure it lands on and
+// never drops anything.
+type AlwaysDeeper struct{}
+
+func (AlwaysDeeper) Turn(s state.State) bool {
+	return false // never surrender! always deeper!
+}
+
+func (AlwaysDeeper) PickUp(s state.State) bool {
+	return true // always pick everything up
+}
+
+func (AlwaysDeeper) Drop(s state.State) (int, bool) {
+	return 0, false
+}
+
+// StrategyNames are the names of the strategies that Named knows about.
+var StrategyNames = []string{"deeper", "cautious", "uniform"}
+
+// Named returns the strategy with the given name, which is one of
+// StrategyNames, drawing any randomness it needs from the given source.
+func Named(name string, rng *rand.Rand) (Strategy, error) {
+	switch name {
+	case "deeper":
+		return AlwaysDeeper{}, nil
+	case "cautious":
+		return FromPolicy(eval.Cautious{}, rng), nil
+	case "uniform":
+		return FromPolicy(eval.Uniform{}, rng), nil
+	}
+
+	return nil, fmt.Errorf("unknown strategy %q", name)
+}
+
+// FromPolicy returns a strategy that makes decisions using the given rollout
+// policy, such as eval.Cautious, so that policies can be played and measured
+// like any other strategy. The policy's randomness comes from the given
+// source when the strategy is played, but from the rollout policy's source
+// when it's used through NewPolicy. The strategy panics if the policy returns
+// an error.
+func FromPolicy(p eval.Policy, rng *rand.Rand) Strategy {
+	return &fromPolicy{policy: p, rng: rng}
+}
+
+type fromPolicy struct {
+	policy eval.Policy
+	rng    *rand.Rand
+}
+
+func (fp *fromPolicy) Turn(s state.State) bool {
+	return fp.decide(s) == state.Turn(true)
+}
+
+func (fp *fromPolicy) PickUp(s state.State) bool {
+	return fp.decide(s) == state.PickUp(true)
+}
+
+func (fp *fromPolicy) Drop(s state.State) (int, bool) {
+	d := fp.decide(s)
+	i := int(d.Value())
+
+	return i, d == state.Drop(i, true)
+}
+
+func (fp *fromPolicy) decide(s state.State) state.Decision {
+	d, err := fp.policy.Decide(s, fp.rng)
+	if err != nil {
+		panic(fmt.Errorf("error deciding with policy: %v", err))
+	}
+
+	return d
+}
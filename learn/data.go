@@ -0,0 +1,97 @@
+// Package learn fits models of deep sea adventure positions to the outcomes
+// of self-play games, which can then be used to evaluate leaves of searches
+// or to play directly.
+package learn
+
+import (
+	"errors"
+	"math/rand"
+
+	"github.com/bubblyworld/deep-sea-adventure/eval"
+	"github.com/bubblyworld/deep-sea-adventure/game"
+	"github.com/bubblyworld/deep-sea-adventure/state"
+)
+
+// Default number of self-play games played by Generate.
+const generateGames = 100
+
+// Sample is a player's position in a self-play game, labelled with how it
+// turned out.
+type Sample struct {
+	Features []float64 // the player's eval.FeatureValues
+	Outcome  float64   // the player's expected score at the end of the round
+}
+
+// GenerateOptions configures Generate.
+type GenerateOptions struct {
+	// Games is the number of games to play, by default generateGames.
+	Games int
+
+	// Seed, if non-zero, seeds the dice so that the samples are
+	// deterministic if the strategies are.
+	Seed int64
+}
+
+// Generate plays self-play games with the given strategies, and returns a
+// sample for every player in every position of them. Samples are labelled
+// with the outcome of the round they're in rather than of the game, since
+// that's what searches evaluate their leaves to by default.
+func Generate(sl []game.Strategy, opts GenerateOptions) ([]Sample, error) {
+	if len(sl) == 0 {
+		return nil, errors.New("no strategies to play")
+	}
+
+	games := opts.Games
+	if games <= 0 {
+		games = generateGames
+	}
+	seed := opts.Seed
+	if seed == 0 {
+		seed = rand.Int63()
+	}
+
+	var res []Sample
+	dice := rand.New(rand.NewSource(seed))
+	pl := game.NewPolicy(sl...)
+	for i := 0; i < games; i++ {
+		s := state.NewStandardState(len(sl))
+		var round []Sample
+		var players []int
+		for s.Stage() != state.StageEndOfGame {
+			for p := range s.Players() {
+				round = append(round, Sample{
+					Features: eval.FeatureValues(s, p),
+				})
+				players = append(players, p)
+			}
+
+			var d state.Decision
+			if s.Stage() == state.StageRoll {
+				d = state.Roll(2 + dice.Intn(3) + dice.Intn(3))
+			} else {
+				var err error
+				if d, err = pl.Decide(s, dice); err != nil {
+					return nil, err
+				}
+			}
+
+			r := s.Round()
+			if err := s.Do(d); err != nil {
+				return nil, err
+			}
+
+			// Once the round is over, its samples can be labelled.
+			if s.Round() != r || s.Stage() == state.StageEndOfGame {
+				ul := eval.ExpectedScore{}.Utilities(s)
+				for j := range round {
+					round[j].Outcome = ul[players[j]]
+				}
+
+				res = append(res, round...)
+				round, players = nil, nil
+			}
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,220 @@
+package learn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+
+	"github.com/bubblyworld/deep-sea-adventure/eval"
+	"github.com/bubblyworld/deep-sea-adventure/game"
+	"github.com/bubblyworld/deep-sea-adventure/state"
+)
+
+// Model is a linear model of a player's expected score at the end of the
+// round, in terms of the features of their position.
+type Model struct {
+	Weights eval.Weights `json:"weights"`
+	Bias    float64      `json:"bias"`
+}
+
+// Fit returns the linear model that best fits the given samples, which is
+// the one that minimises the mean squared error of its predictions plus the
+// given ridge penalty times the sum of the squared feature weights. A small
+// penalty keeps the fit stable when features are constant or correlated, as
+// some always are in small games.
+func Fit(samples []Sample, ridge float64) (*Model, error) {
+	if len(samples) == 0 {
+		return nil, errors.New("no samples to fit")
+	}
+	if ridge < 0 {
+		return nil, fmt.Errorf("invalid ridge penalty %v", ridge)
+	}
+
+	// The normal equations are solved for the feature weights followed by
+	// the bias, which isn't penalised.
+	n := len(eval.Features) + 1
+	a := make([][]float64, n)
+	for i := range a {
+		a[i] = make([]float64, n+1)
+	}
+	for _, smp := range samples {
+		x := append(append([]float64(nil), smp.Features...), 1)
+		for i := range x {
+			for j := range x {
+				a[i][j] += x[i] * x[j]
+			}
+			a[i][n] += x[i] * smp.Outcome
+		}
+	}
+	for i := 0; i < n-1; i++ {
+		a[i][i] += ridge * float64(len(samples))
+	}
+
+	w, err := solve(a)
+	if err != nil {
+		return nil, err
+	}
+
+	m := Model{Weights: make(eval.Weights), Bias: w[n-1]}
+	for i, f := range eval.Features {
+		if w[i] != 0 {
+			m.Weights[f.Name] = w[i]
+		}
+	}
+
+	return &m, nil
+}
+
+// solve solves the given augmented system of linear equations by gaussian
+// elimination with partial pivoting.
+func solve(a [][]float64) ([]float64, error) {
+	n := len(a)
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return nil, errors.New("samples don't determine a unique fit, " +
+				"try a ridge penalty")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+
+		for row := col + 1; row < n; row++ {
+			f := a[row][col] / a[col][col]
+			for j := col; j <= n; j++ {
+				a[row][j] -= f * a[col][j]
+			}
+		}
+	}
+
+	x := make([]float64, n)
+	for row := n - 1; row >= 0; row-- {
+		x[row] = a[row][n]
+		for j := row + 1; j < n; j++ {
+			x[row] -= a[row][j] * x[j]
+		}
+		x[row] /= a[row][row]
+	}
+
+	return x, nil
+}
+
+// Predict returns the model's prediction for a position with the given
+// features.
+func (m *Model) Predict(features []float64) float64 {
+	res := m.Bias
+	for i, f := range eval.Features {
+		res += m.Weights[f.Name] * features[i]
+	}
+
+	return res
+}
+
+// Value returns the model's prediction of the given player's expected score
+// at the end of the round.
+func (m *Model) Value(s state.State, player int) float64 {
+	return m.Predict(eval.FeatureValues(s, player))
+}
+
+// Error returns the mean squared error of the model's predictions for the
+// given samples.
+func (m *Model) Error(samples []Sample) float64 {
+	var res float64
+	for _, smp := range samples {
+		d := m.Predict(smp.Features) - smp.Outcome
+		res += d * d
+	}
+
+	return res / float64(len(samples))
+}
+
+// Leaf returns a leaf evaluator that evaluates leaves with the model. Like
+// eval.Featured, predictions are clamped to the scores players can still end
+// up with, which keeps them within the bounds that pruned searches rely on.
+func (m *Model) Leaf() eval.LeafEvaluator {
+	w := m.Weights
+	if w == nil {
+		w = eval.Weights{} // not the default weights
+	}
+
+	return eval.Featured{Weights: w, Bias: m.Bias}
+}
+
+// Policy returns a greedy policy, which looks a single decision ahead and
+// makes whichever one the model values most for the current player.
+func (m *Model) Policy() eval.Policy {
+	return greedy{m}
+}
+
+// Strategy returns the model's greedy policy as a strategy.
+func (m *Model) Strategy() game.Strategy {
+	return game.FromPolicy(m.Policy(), nil)
+}
+
+type greedy struct {
+	model *Model
+}
+
+func (g greedy) Decide(s state.State, rng *rand.Rand) (state.Decision, error) {
+	cp := s.CurrentPlayer()
+	var best state.Decision
+	bestValue := math.Inf(-1)
+	for _, vd := range s.ValidDecisions() {
+		if err := s.Do(vd); err != nil {
+			return 0, err
+		}
+
+		v := g.model.Value(s, cp)
+		if err := s.Undo(); err != nil {
+			return 0, err
+		}
+
+		if v > bestValue {
+			best, bestValue = vd, v
+		}
+	}
+
+	return best, nil
+}
+
+// Load reads a model saved by Save.
+func Load(path string) (*Model, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var m Model
+	if err := json.NewDecoder(f).Decode(&m); err != nil {
+		return nil, fmt.Errorf("error parsing model: %v", err)
+	}
+	if err := m.Weights.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+// Save writes the model to the given file as JSON.
+func (m *Model) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
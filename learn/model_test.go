@@ -0,0 +1,152 @@
+package learn
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bubblyworld/deep-sea-adventure/eval"
+	"github.com/bubblyworld/deep-sea-adventure/game"
+	"github.com/bubblyworld/deep-sea-adventure/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func cautious(n int) []game.Strategy {
+	sl := make([]game.Strategy, n)
+	for i := range sl {
+		sl[i] = game.FromPolicy(eval.Cautious{}, nil)
+	}
+
+	return sl
+}
+
+func TestGenerate(t *testing.T) {
+	samples, err := Generate(cautious(2), GenerateOptions{Games: 2, Seed: 1})
+	require.NoError(t, err)
+	require.NotEmpty(t, samples)
+
+	// Stashed treasure can't be lost by the end of the round.
+	for _, smp := range samples {
+		require.Len(t, smp.Features, len(eval.Features))
+		assert.True(t, smp.Outcome >= smp.Features[0], "%+v", smp)
+	}
+
+	again, err := Generate(cautious(2), GenerateOptions{Games: 2, Seed: 1})
+	require.NoError(t, err)
+	assert.Equal(t, samples, again)
+}
+
+// TestFit checks that an exactly linear relationship is recovered.
+func TestFit(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var samples []Sample
+	for i := 0; i < 100; i++ {
+		fl := make([]float64, len(eval.Features))
+		for j := range fl {
+			fl[j] = rng.Float64()
+		}
+
+		samples = append(samples, Sample{
+			Features: fl,
+			Outcome:  2*fl[0] - fl[3] + 1,
+		})
+	}
+
+	m, err := Fit(samples, 0)
+	require.NoError(t, err)
+	assert.InDelta(t, 1, m.Bias, 1e-6)
+	for i, f := range eval.Features {
+		exp := map[int]float64{0: 2, 3: -1}[i]
+		assert.InDelta(t, exp, m.Weights[f.Name], 1e-6, f.Name)
+	}
+	assert.InDelta(t, 0, m.Error(samples), 1e-9)
+
+	// Constant features can't be told apart from the bias without a
+	// ridge penalty.
+	for i := range samples {
+		samples[i].Features[5] = 0
+	}
+	_, err = Fit(samples, 0)
+	assert.Error(t, err)
+	_, err = Fit(samples, 1e-3)
+	assert.NoError(t, err)
+}
+
+func TestModel(t *testing.T) {
+	samples, err := Generate(cautious(3), GenerateOptions{Games: 20, Seed: 1})
+	require.NoError(t, err)
+	m, err := Fit(samples, 1e-3)
+	require.NoError(t, err)
+
+	// The model should at least beat always predicting the mean.
+	var mean float64
+	for _, smp := range samples {
+		mean += smp.Outcome
+	}
+	baseline := Model{Bias: mean / float64(len(samples))}
+	assert.True(t, m.Error(samples) < baseline.Error(samples))
+
+	s := state.NewStandardState(3)
+	ul, err := m.Leaf().Evaluate(eval.Leaf{State: s})
+	require.NoError(t, err)
+	for i, u := range ul {
+		assert.InDelta(t, m.Value(s, i), u, 1e-9)
+	}
+
+	// Greedy strategies can play games.
+	_, err = Generate([]game.Strategy{m.Strategy(), m.Strategy()},
+		GenerateOptions{Games: 1, Seed: 1})
+	assert.NoError(t, err)
+}
+
+// TestModelPruning checks that searches with a model's leaves give the same
+// values with and without pruning, even if its predictions are out of bounds.
+func TestModelPruning(t *testing.T) {
+	samples, err := Generate(cautious(3), GenerateOptions{Games: 20, Seed: 1})
+	require.NoError(t, err)
+	trained, err := Fit(samples, 1e-3)
+	require.NoError(t, err)
+	negative := &Model{Weights: eval.Weights{"held": 1, "stashed": 1},
+		Bias: -4}
+
+	rng := rand.New(rand.NewSource(1))
+	for _, m := range []*Model{trained, negative} {
+		s := state.NewStandardState(3)
+		for s.Stage() != state.StageEndOfGame {
+			opts := eval.Options{Depth: 2, Leaf: m.Leaf(),
+				DisableSolver: true, DisablePruning: true}
+			exp, err := eval.Evaluate(s, opts)
+			require.NoError(t, err)
+			opts.DisablePruning = false
+			dm, err := eval.Evaluate(s, opts)
+			require.NoError(t, err)
+			for d, v := range exp {
+				assert.InDelta(t, v, dm[d], 1e-9, "decision %s", d)
+			}
+
+			vdl := s.ValidDecisions()
+			require.NoError(t, s.Do(vdl[rng.Intn(len(vdl))]))
+		}
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "model")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "model.json")
+	m := &Model{Weights: eval.Weights{"held": 0.5}, Bias: 2}
+	require.NoError(t, m.Save(path))
+	loaded, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, m, loaded)
+
+	require.NoError(t, ioutil.WriteFile(path,
+		[]byte(`{"weights": {"luck": 1}}`), 0644))
+	_, err = Load(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,522 @@
+package learn
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+
+	"github.com/bubblyworld/deep-sea-adventure/eval"
+	"github.com/bubblyworld/deep-sea-adventure/game"
+	"github.com/bubblyworld/deep-sea-adventure/state"
+)
+
+// Sizes of the bands that depths and air are abstracted into, and the most
+// held stacks that are told apart.
+const (
+	depthBand = 3
+	airBand   = 3
+	maxHeld   = 4
+)
+
+// Defaults for TrainOptions.
+const (
+	trainGames       = 1000
+	trainPlayers     = 3
+	trainEpsilon     = 0.1
+	trainCheckpoints = 10
+	trainEvalGames   = 100
+)
+
+// Situation is an abstraction of a player's position, which is what a
+// QTable learns the values of decisions for. Positions in the same situation
+// are assumed to call for the same decisions.
+type Situation struct {
+	Stage  state.Stage `json:"stage"`  // turn, pick up or drop
+	Round  int         `json:"round"`  // round of the game
+	Depth  int         `json:"depth"`  // position, in bands of tiles
+	Air    int         `json:"air"`    // air left, in bands of airBand
+	Held   int         `json:"held"`   // stacks held, up to maxHeld
+	Turned bool        `json:"turned"` // whether the player has turned
+	AtSea  int         `json:"at_sea"` // opponents who aren't back yet
+}
+
+// situation returns the current player's situation in the given state.
+func situation(s state.State) Situation {
+	p := s.Players()[s.CurrentPlayer()]
+	sit := Situation{
+		Stage:  s.Stage(),
+		Round:  s.Round(),
+		Depth:  p.Position / depthBand,
+		Air:    s.Air() / airBand,
+		Held:   len(p.HeldTreasure),
+		Turned: p.TurnedAround,
+	}
+	if sit.Held > maxHeld {
+		sit.Held = maxHeld
+	}
+	for i, op := range s.Players() {
+		if i != s.CurrentPlayer() && !op.Done() {
+			sit.AtSea++
+		}
+	}
+
+	return sit
+}
+
+// less orders situations field by field, in the order they're declared.
+func (sit Situation) less(o Situation) bool {
+	al := []int{int(sit.Stage), sit.Round, sit.Depth, sit.Air, sit.Held,
+		boolInt(sit.Turned), sit.AtSea}
+	bl := []int{int(o.Stage), o.Round, o.Depth, o.Air, o.Held,
+		boolInt(o.Turned), o.AtSea}
+	for i := range al {
+		if al[i] != bl[i] {
+			return al[i] < bl[i]
+		}
+	}
+
+	return false
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+// QTable is a table of the values of the two choices a player has in each
+// situation, which are yes or no to turning around, picking up treasure, or
+// dropping their least valuable stack. Values are the average treasure the
+// player went on to stash by the end of the round, learned by Monte-Carlo
+// control (see Train).
+type QTable struct {
+	entries map[Situation]*qEntry
+}
+
+type qEntry struct {
+	Values [2]float64 // mean return of no and yes
+	Visits [2]int     // number of returns averaged
+}
+
+// NewQTable returns an empty table.
+func NewQTable() *QTable {
+	return &QTable{entries: make(map[Situation]*qEntry)}
+}
+
+// Len returns the number of situations in the table.
+func (t *QTable) Len() int {
+	return len(t.entries)
+}
+
+// choice returns the choice the table prefers in the given situation, and
+// false if it's never been in the situation.
+func (t *QTable) choice(sit Situation) (bool, bool) {
+	e, ok := t.entries[sit]
+	if !ok || e.Visits[0]+e.Visits[1] == 0 {
+		return false, false
+	}
+
+	// Choices that have never been tried are assumed to be worse.
+	switch {
+	case e.Visits[0] == 0:
+		return true, true
+	case e.Visits[1] == 0:
+		return false, true
+	}
+
+	return e.Values[1] > e.Values[0], true
+}
+
+// update averages the given return into the value of the given choice.
+func (t *QTable) update(sit Situation, yes bool, ret float64) {
+	e, ok := t.entries[sit]
+	if !ok {
+		e = new(qEntry)
+		t.entries[sit] = e
+	}
+
+	i := 0
+	if yes {
+		i = 1
+	}
+	e.Visits[i]++
+	e.Values[i] += (ret - e.Values[i]) / float64(e.Visits[i])
+}
+
+// Strategy returns a strategy that makes the table's preferred choices.
+// Situations the table has never been in are played like eval.Cautious.
+func (t *QTable) Strategy() game.Strategy {
+	return &tabular{table: t}
+}
+
+// tabular plays with a table, making random choices with probability epsilon
+// and recording every choice it makes if it's learning. Stages with a single
+// valid decision, like turning around at the end of the board, aren't choices
+// and are never recorded.
+type tabular struct {
+	table    *QTable
+	epsilon  float64
+	rng      *rand.Rand
+	learning bool
+	visits   []visit
+}
+
+// visit is a choice made by a learning strategy.
+type visit struct {
+	sit Situation
+	yes bool
+}
+
+func (tb *tabular) Turn(s state.State) bool {
+	return tb.choose(s)
+}
+
+func (tb *tabular) PickUp(s state.State) bool {
+	return tb.choose(s)
+}
+
+func (tb *tabular) Drop(s state.State) (int, bool) {
+	if !tb.choose(s) {
+		return 0, false
+	}
+
+	// Dropping gets rid of the least valuable stack.
+	p := s.Players()[s.CurrentPlayer()]
+	var worst int
+	for i, ts := range p.HeldTreasure {
+		if stackValue(ts) < stackValue(p.HeldTreasure[worst]) {
+			worst = i
+		}
+	}
+
+	return worst, true
+}
+
+func (tb *tabular) choose(s state.State) bool {
+	if vdl := s.ValidDecisions(); len(vdl) == 1 {
+		return vdl[0] == state.Turn(true) || vdl[0] == state.PickUp(true)
+	}
+
+	sit := situation(s)
+	yes, ok := tb.table.choice(sit)
+	switch {
+	case tb.learning && tb.rng.Float64() < tb.epsilon:
+		yes = tb.rng.Intn(2) == 1
+
+	case !ok:
+		d, _ := eval.Cautious{}.Decide(s, tb.rng)
+		yes = d == state.Turn(true) || d == state.PickUp(true)
+	}
+
+	if tb.learning {
+		tb.visits = append(tb.visits, visit{sit: sit, yes: yes})
+	}
+
+	return yes
+}
+
+// stackValue returns the expected value of the given stack of treasure.
+func stackValue(ts state.TreasureStack) float64 {
+	var res float64
+	for _, t := range ts {
+		vl := state.TreasureValues(t.Type)
+		for _, v := range vl {
+			res += float64(v) / float64(len(vl))
+		}
+	}
+
+	return res
+}
+
+// TrainOptions configures Train.
+type TrainOptions struct {
+	// Games is the number of games to learn from, by default trainGames.
+	Games int
+
+	// Players is the number of players in each game, by default
+	// trainPlayers. The learner plays every seat in turn.
+	Players int
+
+	// Opponent plays every seat but the learner's, like eval.Cautious by
+	// default.
+	Opponent game.Strategy
+
+	// Epsilon is the probability of the learner making a random choice to
+	// explore, by default trainEpsilon.
+	Epsilon float64
+
+	// Baselines are the strategies to compare the learned strategy with
+	// for the learning curve, by name. By default it's compared with the
+	// strategies returned by game.Named.
+	Baselines map[string]game.Strategy
+
+	// Checkpoints is the number of points on the learning curve, evenly
+	// spaced over the games, by default trainCheckpoints.
+	Checkpoints int
+
+	// EvalGames is the number of games to play against each baseline at
+	// each checkpoint, by default trainEvalGames.
+	EvalGames int
+
+	// Seed, if non-zero, seeds the dice and the exploration so that
+	// training is deterministic if the other strategies are. The dice,
+	// exploration and default opponent each have their own source, so that
+	// changing how often the learner explores doesn't change the dice, and
+	// games against the baselines use their own sources too, so that
+	// comparisons don't change the games that are learned from.
+	Seed int64
+}
+
+// CurvePoint is a point on a learning curve.
+type CurvePoint struct {
+	Games  int               // games learned from so far
+	Versus map[string]Versus // comparison with each baseline by name
+}
+
+// Versus compares the learned strategy with a baseline in games where the
+// learned strategy plays one seat and the baseline plays the rest.
+type Versus struct {
+	Learned  float64 // mean final expected score of the learned strategy
+	Baseline float64 // mean final expected score of the baseline's seats
+}
+
+// Train improves the table by playing games against the options' opponent,
+// and returns the learning curve. The learner makes the table's preferred
+// choices, or explores with a random choice, and at the end of each round
+// every choice it made is credited with the expected value of the treasure
+// it stashed in the round. Choices are only credited with what happens in
+// their own round, since stashed treasure is safe for good.
+func (t *QTable) Train(opts TrainOptions) ([]CurvePoint, error) {
+	games := opts.Games
+	if games <= 0 {
+		games = trainGames
+	}
+	players := opts.Players
+	if players <= 0 {
+		players = trainPlayers
+	}
+	epsilon := opts.Epsilon
+	if epsilon <= 0 {
+		epsilon = trainEpsilon
+	}
+	checkpoints := opts.Checkpoints
+	if checkpoints <= 0 {
+		checkpoints = trainCheckpoints
+	}
+	seed := opts.Seed
+	if seed == 0 {
+		seed = rand.Int63()
+	}
+
+	seeds := rand.New(rand.NewSource(seed))
+	dice := rand.New(rand.NewSource(seeds.Int63()))
+	explore := rand.New(rand.NewSource(seeds.Int63()))
+	opponent := opts.Opponent
+	if opponent == nil {
+		orng := rand.New(rand.NewSource(seeds.Int63()))
+		opponent = game.FromPolicy(eval.Cautious{}, orng)
+	}
+	baselines := opts.Baselines
+	if baselines == nil {
+		baselines = make(map[string]game.Strategy)
+		for _, name := range game.StrategyNames {
+			brng := rand.New(rand.NewSource(seeds.Int63()))
+			st, err := game.Named(name, brng)
+			if err != nil {
+				return nil, err
+			}
+
+			baselines[name] = st
+		}
+	}
+
+	// Baselines are compared in order of name, each on the same dice.
+	var names []string
+	for name := range baselines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	evalSeed := seeds.Int63()
+
+	learner := &tabular{
+		table:    t,
+		epsilon:  epsilon,
+		rng:      explore,
+		learning: true,
+	}
+
+	var curve []CurvePoint
+	for i := 0; i < games; i++ {
+		seat := i % players
+		sl := make([]game.Strategy, players)
+		for j := range sl {
+			sl[j] = opponent
+		}
+		sl[seat] = learner
+
+		if err := t.learn(sl, seat, learner, dice); err != nil {
+			return nil, err
+		}
+
+		if (i+1)%((games+checkpoints-1)/checkpoints) == 0 || i+1 == games {
+			p := CurvePoint{Games: i + 1, Versus: make(map[string]Versus)}
+			for _, name := range names {
+				edice := rand.New(rand.NewSource(evalSeed))
+				v, err := compare(t.Strategy(), baselines[name], players,
+					opts.EvalGames, edice)
+				if err != nil {
+					return nil, err
+				}
+
+				p.Versus[name] = v
+			}
+
+			curve = append(curve, p)
+		}
+	}
+
+	return curve, nil
+}
+
+// learn plays a game with the given strategies and dice, crediting the
+// learner's choices with its stash at the end of each round.
+func (t *QTable) learn(sl []game.Strategy, seat int, learner *tabular,
+	dice *rand.Rand) error {
+
+	g := &game.Game{
+		State:      state.NewStandardState(len(sl)),
+		Strategies: sl,
+		Dice:       dice,
+	}
+
+	stashed := stash(g.State, seat)
+	for g.State.Stage() != state.StageEndOfGame {
+		round := g.State.Round()
+		if err := g.Step(); err != nil {
+			return err
+		}
+
+		if g.State.Round() != round {
+			ret := stash(g.State, seat) - stashed
+			for _, v := range learner.visits {
+				t.update(v.sit, v.yes, ret)
+			}
+
+			learner.visits = learner.visits[:0]
+			stashed = stash(g.State, seat)
+		}
+	}
+
+	return nil
+}
+
+// stash returns the expected value of the given player's stashed treasure.
+func stash(s state.State, player int) float64 {
+	return eval.ExpectedScore{}.Utilities(s)[player]
+}
+
+// compare plays the given number of games with the learned strategy in one
+// seat and the baseline in the rest, rotating the learned strategy's seat.
+func compare(learned, baseline game.Strategy, players, games int,
+	rng *rand.Rand) (Versus, error) {
+
+	if games <= 0 {
+		games = trainEvalGames
+	}
+
+	var v Versus
+	for i := 0; i < games; i++ {
+		seat := i % players
+		sl := make([]game.Strategy, players)
+		for j := range sl {
+			sl[j] = baseline
+		}
+		sl[seat] = learned
+
+		g := &game.Game{
+			State:      state.NewStandardState(players),
+			Strategies: sl,
+			Dice:       rng,
+		}
+		for g.State.Stage() != state.StageEndOfGame {
+			if err := g.Step(); err != nil {
+				return Versus{}, err
+			}
+		}
+
+		for j := range sl {
+			if j == seat {
+				v.Learned += stash(g.State, j) / float64(games)
+			} else {
+				v.Baseline += stash(g.State, j) /
+					float64(games*(players-1))
+			}
+		}
+	}
+
+	return v, nil
+}
+
+// qFile is the format of saved tables.
+type qFile struct {
+	Entries []qFileEntry `json:"entries"`
+}
+
+type qFileEntry struct {
+	Situation
+	Values [2]float64 `json:"values"`
+	Visits [2]int     `json:"visits"`
+}
+
+// Save writes the table to the given file as JSON. Situations are written in
+// order, so that saving the same table always writes the same file.
+func (t *QTable) Save(path string) error {
+	var qf qFile
+	for sit, e := range t.entries {
+		qf.Entries = append(qf.Entries, qFileEntry{
+			Situation: sit,
+			Values:    e.Values,
+			Visits:    e.Visits,
+		})
+	}
+	sort.Slice(qf.Entries, func(i, j int) bool {
+		return qf.Entries[i].Situation.less(qf.Entries[j].Situation)
+	})
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := json.NewEncoder(f).Encode(qf); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// LoadQTable reads a table saved by Save.
+func LoadQTable(path string) (*QTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var qf qFile
+	if err := json.NewDecoder(f).Decode(&qf); err != nil {
+		return nil, fmt.Errorf("error parsing table: %v", err)
+	}
+
+	t := NewQTable()
+	for _, e := range qf.Entries {
+		t.entries[e.Situation] = &qEntry{Values: e.Values, Visits: e.Visits}
+	}
+
+	return t, nil
+}
@@ -0,0 +1,129 @@
+package learn
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bubblyworld/deep-sea-adventure/eval"
+	"github.com/bubblyworld/deep-sea-adventure/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSituation(t *testing.T) {
+	s := state.NewStandardState(3)
+	require.NoError(t, s.Do(state.Roll(4)))
+	require.NoError(t, s.Do(state.PickUp(true)))
+	require.NoError(t, s.Do(state.Roll(2)))
+
+	assert.Equal(t, Situation{
+		Stage: state.StagePickUp,
+		Round: 1,
+		Depth: 2 / depthBand,
+		Air:   25 / airBand,
+		AtSea: 2, // nobody has turned around yet
+	}, situation(s))
+}
+
+// TestQTableStrategy checks that an empty table plays like eval.Cautious.
+func TestQTableStrategy(t *testing.T) {
+	st := NewQTable().Strategy()
+	s := state.NewStandardState(2)
+	for s.Stage() != state.StageEndOfGame {
+		var d state.Decision
+		switch s.Stage() {
+		case state.StageRoll:
+			d = state.Roll(3)
+		case state.StageTurn:
+			d = state.Turn(st.Turn(s))
+		case state.StagePickUp:
+			d = state.PickUp(st.PickUp(s))
+		case state.StageDrop:
+			d = state.Drop(st.Drop(s))
+		}
+
+		if s.Stage() != state.StageRoll {
+			exp, err := eval.Cautious{}.Decide(s, nil)
+			require.NoError(t, err)
+			assert.Equal(t, exp, d)
+		}
+		require.NoError(t, s.Do(d))
+	}
+}
+
+// TestTabularForced checks that stages with a single valid decision are
+// played without being recorded as choices, even when exploring.
+func TestTabularForced(t *testing.T) {
+	sn := state.Snap(state.NewStandardState(2))
+	sn.Players[0].Position = len(sn.Tiles) - 1
+	sn.Stage = state.StageTurn
+	s := state.NewStandardStateFrom(sn)
+	require.Equal(t, []state.Decision{state.Turn(true)}, s.ValidDecisions())
+
+	tb := &tabular{
+		table:    NewQTable(),
+		epsilon:  1,
+		rng:      rand.New(rand.NewSource(1)),
+		learning: true,
+	}
+	for i := 0; i < 10; i++ {
+		assert.True(t, tb.Turn(s))
+	}
+	assert.Empty(t, tb.visits)
+}
+
+func TestTrain(t *testing.T) {
+	train := func() (*QTable, []CurvePoint) {
+		qt := NewQTable()
+		curve, err := qt.Train(TrainOptions{
+			Games:       200,
+			Checkpoints: 2,
+			EvalGames:   10,
+			Seed:        1,
+		})
+		require.NoError(t, err)
+
+		return qt, curve
+	}
+
+	qt, curve := train()
+	assert.True(t, qt.Len() > 0)
+	require.Len(t, curve, 2)
+	assert.Equal(t, 100, curve[0].Games)
+	assert.Equal(t, 200, curve[1].Games)
+	assert.Len(t, curve[1].Versus, 3)
+
+	// Nobody ever stashes anything if they never turn around.
+	assert.Equal(t, 0.0, curve[1].Versus["deeper"].Baseline)
+
+	_, again := train()
+	assert.Equal(t, curve, again)
+}
+
+func TestQTableSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qtable")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	qt := NewQTable()
+	_, err = qt.Train(TrainOptions{Games: 50, EvalGames: 1, Seed: 1})
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "table.json")
+	require.NoError(t, qt.Save(path))
+	loaded, err := LoadQTable(path)
+	require.NoError(t, err)
+	assert.Equal(t, qt, loaded)
+
+	// Saving the same table again writes the same file.
+	again := filepath.Join(dir, "again.json")
+	require.NoError(t, loaded.Save(again))
+	exp, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	b, err := ioutil.ReadFile(again)
+	require.NoError(t, err)
+	assert.Equal(t, exp, b)
+}
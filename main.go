@@ -35,7 +35,7 @@ func main() {
 
 	// Start a game and run it till completion.
 	g := game.New([]game.Strategy{
-		new(alwaysDeeper), new(alwaysDeeper), new(alwaysDeeper)})
+		game.AlwaysDeeper{}, game.AlwaysDeeper{}, game.AlwaysDeeper{}})
 
 	for {
 		if g.State.Stage() == state.StageEndOfGame {
@@ -47,17 +47,3 @@ func main() {
 		time.Sleep(time.Second)
 	}
 }
-
-type alwaysDeeper struct{}
-
-func (ad *alwaysDeeper) Turn(s state.State) bool {
-	return false // never surrender! always deeper!
-}
-
-func (ad *alwaysDeeper) PickUp(s state.State) bool {
-	return true // always pick everything up
-}
-
-func (ad *alwaysDeeper) Drop(s state.State) (int, bool) {
-	return 0, false
-}
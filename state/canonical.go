@@ -0,0 +1,143 @@
+package state
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+)
+
+// Equivalence is a set of flags describing which details of a state are
+// considered irrelevant when deciding whether two states are the same
+// position. The zero value compares states exactly.
+type Equivalence int
+
+const (
+	// EquivalenceTreasureType compares treasure chips by type only, ignoring
+	// their actual values. Values never affect the movement of players, so
+	// this is sound for anything that only cares about treasure types.
+	EquivalenceTreasureType Equivalence = 1 << iota
+
+	// EquivalenceStashOrder ignores the order in which players stashed their
+	// treasure stacks, which has no effect on the game.
+	EquivalenceStashOrder
+
+	// EquivalenceFinishedPlayers treats players who have finished their
+	// round as interchangeable. This is only sound within a single round,
+	// since seat order matters again once the next round begins, and for
+	// utilities that don't care about which seat owns which treasure.
+	EquivalenceFinishedPlayers
+)
+
+// Key is a canonical encoding of a state under some equivalence. Two states
+// have equal keys if and only if they are equivalent.
+type Key string
+
+// Hash returns a 64-bit FNV-1a hash of the key.
+func (k Key) Hash() uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(k))
+	return h.Sum64()
+}
+
+// Canonical returns the canonical key of the given state under the given
+// equivalence. The state's history is not part of its key.
+func Canonical(s State, eq Equivalence) Key {
+	var b []byte
+	b = appendInt(b, s.Round())
+	b = appendInt(b, int(s.Stage()))
+	b = appendInt(b, s.Air())
+	b = appendInt(b, s.CurrentPlayer())
+
+	// Finished players are sorted amongst their own seats, so unfinished
+	// players keep their seats (and the current player index stays valid).
+	players := s.Players()
+	pbl := make([][]byte, len(players))
+	var fl []int
+	for i, p := range players {
+		pbl[i] = appendPlayer(nil, p, eq)
+		if eq&EquivalenceFinishedPlayers != 0 && p.Done() {
+			fl = append(fl, i)
+		}
+	}
+
+	var fbl [][]byte
+	for _, i := range fl {
+		fbl = append(fbl, pbl[i])
+	}
+	sort.Slice(fbl, func(i, j int) bool {
+		return string(fbl[i]) < string(fbl[j])
+	})
+	for j, i := range fl {
+		pbl[i] = fbl[j]
+	}
+
+	b = appendInt(b, len(players))
+	for _, pb := range pbl {
+		b = append(b, pb...)
+	}
+
+	tiles := s.Tiles()
+	b = appendInt(b, len(tiles))
+	for _, t := range tiles {
+		b = appendInt(b, int(t.Type))
+		if t.Treasure != nil {
+			b = appendStack(b, *t.Treasure, eq)
+		}
+	}
+
+	return Key(b)
+}
+
+// Hash returns the hash of the canonical key of the given state under the
+// given equivalence.
+func Hash(s State, eq Equivalence) uint64 {
+	return Canonical(s, eq).Hash()
+}
+
+func appendPlayer(b []byte, p Player, eq Equivalence) []byte {
+	b = appendInt(b, p.Position)
+	if p.TurnedAround {
+		b = appendInt(b, 1)
+	} else {
+		b = appendInt(b, 0)
+	}
+
+	b = appendInt(b, len(p.HeldTreasure))
+	for _, ts := range p.HeldTreasure {
+		b = appendStack(b, ts, eq)
+	}
+
+	sbl := make([][]byte, len(p.StashedTreasure))
+	for i, ts := range p.StashedTreasure {
+		sbl[i] = appendStack(nil, ts, eq)
+	}
+	if eq&EquivalenceStashOrder != 0 {
+		sort.Slice(sbl, func(i, j int) bool {
+			return string(sbl[i]) < string(sbl[j])
+		})
+	}
+
+	b = appendInt(b, len(sbl))
+	for _, sb := range sbl {
+		b = append(b, sb...)
+	}
+
+	return b
+}
+
+func appendStack(b []byte, ts TreasureStack, eq Equivalence) []byte {
+	b = appendInt(b, len(ts))
+	for _, t := range ts {
+		b = appendInt(b, int(t.Type))
+		if eq&EquivalenceTreasureType == 0 {
+			b = appendInt(b, t.Value)
+		}
+	}
+
+	return b
+}
+
+func appendInt(b []byte, n int) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutVarint(buf[:], int64(n))]...)
+}
@@ -0,0 +1,75 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalExact(t *testing.T) {
+	ss := newState([]int{0, 1, 2})
+	clone := ss.clone()
+	assert.Equal(t, Canonical(ss, 0), Canonical(clone, 0))
+	assert.Equal(t, Hash(ss, 0), Hash(clone, 0))
+
+	assert.NoError(t, ss.Do(Roll(2)))
+	assert.NotEqual(t, Canonical(ss, 0), Canonical(clone, 0))
+
+	assert.NoError(t, ss.Undo())
+	assert.Equal(t, Canonical(ss, 0), Canonical(clone, 0))
+}
+
+func TestCanonicalTreasureType(t *testing.T) {
+	ss := newState([]int{0, 1})
+	clone := ss.clone()
+
+	// Swap the values of two tiles of the same type for different chips.
+	clone.tiles[1] = Tile{
+		Type:     TileTypeTreasure,
+		Treasure: &TreasureStack{{Type: TreasureTypeOne, Value: 7}},
+	}
+
+	assert.NotEqual(t, Canonical(ss, 0), Canonical(clone, 0))
+	assert.Equal(t,
+		Canonical(ss, EquivalenceTreasureType),
+		Canonical(clone, EquivalenceTreasureType))
+}
+
+func TestCanonicalStashOrder(t *testing.T) {
+	a := TreasureStack{{Type: TreasureTypeOne, Value: 1}}
+	b := TreasureStack{{Type: TreasureTypeTwo, Value: 4}}
+
+	ss := newState([]int{0, 0})
+	clone := ss.clone()
+	ss.players[0].StashedTreasure = []TreasureStack{a, b}
+	clone.players[0].StashedTreasure = []TreasureStack{b, a}
+
+	assert.NotEqual(t, Canonical(ss, 0), Canonical(clone, 0))
+	assert.Equal(t,
+		Canonical(ss, EquivalenceStashOrder),
+		Canonical(clone, EquivalenceStashOrder))
+}
+
+func TestCanonicalFinishedPlayers(t *testing.T) {
+	a := TreasureStack{{Type: TreasureTypeOne, Value: 1}}
+
+	ss := newState([]int{0, 0, 5})
+	ss.curPlayer = 2
+	for i := 0; i < 2; i++ {
+		ss.players[i].TurnedAround = true
+	}
+	clone := ss.clone()
+	ss.players[0].HeldTreasure = []TreasureStack{a}
+	clone.players[1].HeldTreasure = []TreasureStack{a}
+
+	assert.NotEqual(t, Canonical(ss, 0), Canonical(clone, 0))
+	assert.Equal(t,
+		Canonical(ss, EquivalenceFinishedPlayers),
+		Canonical(clone, EquivalenceFinishedPlayers))
+
+	// Unfinished players are never permuted.
+	clone.players[1].TurnedAround = false
+	assert.NotEqual(t,
+		Canonical(ss, EquivalenceFinishedPlayers),
+		Canonical(clone, EquivalenceFinishedPlayers))
+}
@@ -0,0 +1,219 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+)
+
+// Check returns an error if the given state violates any of the invariants
+// of a standard game of deep sea adventure. The following are verified:
+//   - every treasure chip in the game is on a tile, held or stashed exactly once
+//   - the air, round, current player and player positions are in bounds
+//   - the stage is consistent with the current player's situation
+//   - doing and then undoing each valid decision leaves the state unchanged
+//
+// Check only uses the State interface, so it works for any implementation of
+// the standard rules. Engines with other chip sets, air supplies or numbers of
+// rounds will fail it, since the standard ones are assumed. The state is
+// mutated while checking, but is restored before returning.
+func Check(s State) error {
+	if err := checkBounds(s); err != nil {
+		return err
+	}
+
+	if err := checkTreasure(s); err != nil {
+		return err
+	}
+
+	if err := checkStage(s); err != nil {
+		return err
+	}
+
+	return checkUndo(s)
+}
+
+// RandomPlayouts plays the given number of games to completion, starting
+// from a fresh state created by newState and picking decisions uniformly at
+// random using rng. Every state along the way is verified with Check.
+func RandomPlayouts(newState func() State, games int, rng *rand.Rand) error {
+	for i := 0; i < games; i++ {
+		s := newState()
+
+		var dl []Decision
+		for {
+			if err := Check(s); err != nil {
+				return fmt.Errorf("game %d after %v: %v", i, dl, err)
+			}
+
+			vdl := s.ValidDecisions()
+			if len(vdl) == 0 {
+				break // game is over
+			}
+
+			d := vdl[rng.Intn(len(vdl))]
+			dl = append(dl, d)
+			if err := s.Do(d); err != nil {
+				return fmt.Errorf("game %d after %v: %v", i, dl, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func checkBounds(s State) error {
+	if s.Round() < 1 || s.Round() > 4 {
+		return fmt.Errorf("round %d out of bounds", s.Round())
+	}
+
+	if s.Air() < 0 || s.Air() > 25 {
+		return fmt.Errorf("air %d out of bounds", s.Air())
+	}
+
+	pl := s.Players()
+	if s.CurrentPlayer() < 0 || s.CurrentPlayer() >= len(pl) {
+		return fmt.Errorf("current player %d out of bounds", s.CurrentPlayer())
+	}
+
+	tl := s.Tiles()
+	for i, t := range tl {
+		if (i == 0) != (t.Type == TileTypeSubmarine) {
+			return fmt.Errorf("submarine tile misplaced at %d", i)
+		}
+
+		if (t.Type == TileTypeTreasure) != (t.Treasure != nil) {
+			return fmt.Errorf("tile %d has type %d but treasure %v",
+				i, t.Type, t.Treasure)
+		}
+
+		if t.Treasure != nil && len(*t.Treasure) == 0 {
+			return fmt.Errorf("tile %d has an empty treasure stack", i)
+		}
+	}
+
+	pm := make(map[int]bool)
+	for i, p := range pl {
+		if p.Position < 0 || p.Position >= len(tl) {
+			return fmt.Errorf("player %d in illegal position %d", i, p.Position)
+		}
+
+		if p.Position != 0 && pm[p.Position] {
+			return fmt.Errorf("multiple players occupying tile %d", p.Position)
+		}
+		pm[p.Position] = true
+
+		for _, ts := range owned(p) {
+			if len(ts) == 0 {
+				return fmt.Errorf("player %d owns an empty treasure stack", i)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkTreasure verifies conservation of treasure chips, i.e. that the chips
+// in the game are exactly those of a standard game.
+func checkTreasure(s State) error {
+	cm := make(map[Treasure]int)
+	for _, tt := range TreasureTypes() {
+		for _, v := range treasureValues[tt] {
+			cm[Treasure{Type: tt, Value: v}]++
+		}
+	}
+
+	var tl []Treasure
+	for _, t := range s.Tiles() {
+		if t.Treasure != nil {
+			tl = append(tl, *t.Treasure...)
+		}
+	}
+	for _, p := range s.Players() {
+		for _, ts := range owned(p) {
+			tl = append(tl, ts...)
+		}
+	}
+
+	for _, t := range tl {
+		cm[t]--
+		if cm[t] < 0 {
+			return fmt.Errorf("treasure %v is duplicated", t)
+		}
+	}
+
+	for t, n := range cm {
+		if n > 0 {
+			return fmt.Errorf("treasure %v is missing", t)
+		}
+	}
+
+	return nil
+}
+
+func checkStage(s State) error {
+	if (s.Stage() == StageEndOfGame) != (s.Round() > 3) {
+		return fmt.Errorf("stage %s in round %d", s.Stage(), s.Round())
+	}
+
+	cp := s.Players()[s.CurrentPlayer()]
+	tile := s.Tiles()[cp.Position]
+	switch s.Stage() {
+	case StageRoll:
+		if cp.Done() {
+			return errors.New("finished player is rolling")
+		}
+
+	case StagePickUp:
+		if tile.Type != TileTypeTreasure {
+			return errors.New("picking up from a non-treasure tile")
+		}
+
+	case StageDrop:
+		if tile.Type != TileTypeEmpty || len(cp.HeldTreasure) == 0 {
+			return errors.New("dropping without an empty tile and treasure")
+		}
+
+	case StageTurn:
+		if cp.Position == 0 || cp.TurnedAround {
+			return errors.New("turning in the submarine or after turning")
+		}
+
+	case StageEndOfGame:
+		if len(s.ValidDecisions()) > 0 {
+			return errors.New("valid decisions after the end of the game")
+		}
+
+	default:
+		return fmt.Errorf("unknown stage %d", s.Stage())
+	}
+
+	return nil
+}
+
+// checkUndo verifies that undoing each valid decision restores the state.
+func checkUndo(s State) error {
+	key := Canonical(s, 0)
+	for _, d := range s.ValidDecisions() {
+		if err := s.Do(d); err != nil {
+			return fmt.Errorf("error doing %s: %v", d, err)
+		}
+
+		if err := s.Undo(); err != nil {
+			return fmt.Errorf("error undoing %s: %v", d, err)
+		}
+
+		if Canonical(s, 0) != key {
+			return fmt.Errorf("undoing %s did not restore the state", d)
+		}
+	}
+
+	return nil
+}
+
+// owned returns all of the treasure stacks held or stashed by the player.
+func owned(p Player) []TreasureStack {
+	var tsl []TreasureStack
+	tsl = append(tsl, p.HeldTreasure...)
+	return append(tsl, p.StashedTreasure...)
+}
@@ -0,0 +1,62 @@
+package state
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	ss := NewStandardState(3)
+	assert.NoError(t, Check(ss))
+
+	ss.air = 26
+	assert.Error(t, Check(ss))
+	ss.air = 25
+
+	// Duplicate a treasure chip, which breaks conservation.
+	ss.players[0].HeldTreasure = []TreasureStack{*ss.tiles[1].Treasure}
+	assert.Error(t, Check(ss))
+	ss.players[0].HeldTreasure = nil
+
+	ss.stage = StageTurn // player 0 is in the submarine
+	assert.Error(t, Check(ss))
+	ss.stage = StageRoll
+
+	assert.NoError(t, Check(ss))
+}
+
+// TestDropUndo picks up two treasures and drops the first, which used to
+// corrupt the held treasure of both the state and its history.
+func TestDropUndo(t *testing.T) {
+	ss := newState([]int{0, 1})
+	assert.NoError(t, ss.pickup(&ss.players[1]))
+	ss.players[1].Position = 2
+	assert.NoError(t, ss.pickup(&ss.players[1]))
+	ss.players[1].Position = 1
+	ss.curPlayer = 1
+	ss.stage = StageDrop
+	assert.NoError(t, Check(ss))
+
+	assert.NoError(t, ss.Do(Drop(0, true)))
+	assert.Len(t, ss.players[1].HeldTreasure, 1)
+	assert.NoError(t, Check(ss))
+}
+
+// TestRandomPlayouts checks random games with every supported number of
+// players, each seeded so that failures can be reproduced.
+func TestRandomPlayouts(t *testing.T) {
+	games := 100
+	if testing.Short() {
+		games = 10
+	}
+
+	for players := 2; players <= 6; players++ {
+		players := players
+		newState := func() State { return NewStandardState(players) }
+		rng := rand.New(rand.NewSource(int64(players)))
+		assert.NoError(t, RandomPlayouts(newState, games, rng),
+			"%d players", players)
+	}
+}
@@ -0,0 +1,14 @@
+package state_test
+
+import (
+	"testing"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+	"github.com/bubblyworld/deep-sea-adventure/state/statetest"
+)
+
+func TestStandardStateConformance(t *testing.T) {
+	statetest.Run(t, func(players int) state.State {
+		return state.NewStandardState(players)
+	})
+}
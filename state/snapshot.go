@@ -0,0 +1,99 @@
+package state
+
+// Snapshot is a copy of the position of a game state, i.e. everything that
+// can be observed through the State interface.
+type Snapshot struct {
+	Round         int
+	Stage         Stage
+	Air           int
+	CurrentPlayer int
+	Players       []Player
+	Tiles         []Tile
+}
+
+// Snap returns a snapshot of the given state's position. Players and tiles
+// are deep copies, so the snapshot can be modified without affecting the
+// state and vice versa.
+func Snap(s State) Snapshot {
+	sn := Snapshot{
+		Round:         s.Round(),
+		Stage:         s.Stage(),
+		Air:           s.Air(),
+		CurrentPlayer: s.CurrentPlayer(),
+		Players:       make([]Player, len(s.Players())),
+		Tiles:         make([]Tile, len(s.Tiles())),
+	}
+
+	for i, p := range s.Players() {
+		sn.Players[i] = Player{
+			Position:        p.Position,
+			TurnedAround:    p.TurnedAround,
+			HeldTreasure:    copyStacks(p.HeldTreasure),
+			StashedTreasure: copyStacks(p.StashedTreasure),
+		}
+	}
+
+	for i, t := range s.Tiles() {
+		sn.Tiles[i] = Tile{Type: t.Type}
+		if t.Treasure != nil {
+			ts := copyStack(*t.Treasure)
+			sn.Tiles[i].Treasure = &ts
+		}
+	}
+
+	return sn
+}
+
+// NewStandardStateFrom returns a standard state in the position of the given
+// snapshot, with no history. The snapshot is copied, so it can be reused.
+func NewStandardStateFrom(sn Snapshot) *standardState {
+	cp := Snap(&standardState{
+		air:       sn.Air,
+		round:     sn.Round,
+		stage:     sn.Stage,
+		curPlayer: sn.CurrentPlayer,
+		players:   sn.Players,
+		tiles:     sn.Tiles,
+	})
+
+	return &standardState{
+		air:       cp.Air,
+		round:     cp.Round,
+		stage:     cp.Stage,
+		curPlayer: cp.CurrentPlayer,
+		players:   cp.Players,
+		tiles:     cp.Tiles,
+	}
+}
+
+// Cloner is implemented by states that can copy themselves, which lets
+// searches split their work between goroutines with their own copies.
+type Cloner interface {
+	// Clone returns a copy of the state in the same position, with no
+	// history. Changes to either don't affect the other.
+	Clone() State
+}
+
+// Clone returns a standard state in the same position, with no history.
+func (ss *standardState) Clone() State {
+	return NewStandardStateFrom(Snap(ss))
+}
+
+func copyStacks(tsl []TreasureStack) []TreasureStack {
+	if tsl == nil {
+		return nil
+	}
+
+	res := make([]TreasureStack, len(tsl))
+	for i, ts := range tsl {
+		res[i] = copyStack(ts)
+	}
+
+	return res
+}
+
+func copyStack(ts TreasureStack) TreasureStack {
+	res := make(TreasureStack, len(ts))
+	copy(res, ts)
+	return res
+}
@@ -0,0 +1,33 @@
+package state
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	ss := NewStandardState(4)
+	for i := 0; i < 50; i++ {
+		vdl := ss.ValidDecisions()
+		require.NoError(t, ss.Do(vdl[rand.Intn(len(vdl))]))
+	}
+
+	sn := Snap(ss)
+	cp := NewStandardStateFrom(sn)
+	assert.Equal(t, Canonical(ss, 0), Canonical(cp, 0))
+	assert.Empty(t, cp.history)
+	assert.NoError(t, Check(cp))
+
+	// Modifying the snapshot or the copy doesn't affect the original.
+	key := Canonical(ss, 0)
+	sn.Tiles[1].Type = TileTypeEmpty
+	(*cp.tiles[len(cp.tiles)-1].Treasure)[0].Value = -1
+	for i := range cp.players {
+		cp.players[i].Position = 0
+	}
+	assert.Equal(t, key, Canonical(ss, 0))
+	assert.NotEqual(t, Canonical(cp, 0), Canonical(NewStandardStateFrom(sn), 0))
+}
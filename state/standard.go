@@ -39,8 +39,8 @@ func NewStandardState(players int) *standardState {
 		Type: TileTypeSubmarine,
 	})
 
-	for _, tt := range getTreasureTypes() {
-		vl := getTreasureValues(tt)
+	for _, tt := range TreasureTypes() {
+		vl := TreasureValues(tt)
 		rand.Shuffle(len(vl), func(i, j int) {
 			vl[i], vl[j] = vl[j], vl[i]
 		})
@@ -123,11 +123,6 @@ func (ss *standardState) ValidDecisions() []Decision {
 }
 
 func (ss *standardState) Do(d Decision) error {
-	// We're about to alter the state in some way, so push a copy of the state
-	// onto the history stack for Undo() calls.
-	ssCopy := ss.clone()
-	ss.history = append(ss.history, ssCopy)
-
 	var valid bool
 	for _, vd := range ss.ValidDecisions() {
 		if vd == d {
@@ -139,6 +134,11 @@ func (ss *standardState) Do(d Decision) error {
 		return errors.New("attempted to do invalid decision")
 	}
 
+	// We're about to alter the state in some way, so push a copy of the state
+	// onto the history stack for Undo() calls.
+	ssCopy := ss.clone()
+	ss.history = append(ss.history, ssCopy)
+
 	cp := &ss.players[ss.curPlayer]
 	switch ss.stage {
 	case StageRoll:
@@ -316,12 +316,17 @@ func (ss *standardState) drop(p *Player, index int) error {
 		return errors.New("player tried to drop on non-empty tile")
 	}
 
+	// The held treasure slice is shared with the state history, so we have
+	// to build a new one rather than removing the stack in place.
+	ts := p.HeldTreasure[index]
 	ss.tiles[p.Position] = Tile{
 		Type:     TileTypeTreasure,
-		Treasure: &p.HeldTreasure[index],
+		Treasure: &ts,
 	}
-	p.HeldTreasure = append(p.HeldTreasure[:index],
-		p.HeldTreasure[:index+1]...)
+
+	var held []TreasureStack
+	held = append(held, p.HeldTreasure[:index]...)
+	p.HeldTreasure = append(held, p.HeldTreasure[index+1:]...)
 
 	return nil
 }
@@ -458,7 +463,8 @@ func isFinished(p Player) bool {
 	return p.Position == 0 && p.TurnedAround
 }
 
-func getTreasureTypes() []TreasureType {
+// TreasureTypes returns every type of treasure in a standard game.
+func TreasureTypes() []TreasureType {
 	var res []TreasureType
 	for tt := TreasureTypeOne; tt != treasureTypeSentinel; tt++ {
 		res = append(res, tt)
@@ -474,7 +480,9 @@ var treasureValues = map[TreasureType][]int{
 	TreasureTypeFour:  []int{12, 12, 13, 13, 14, 14, 15, 15},
 }
 
-func getTreasureValues(tt TreasureType) []int {
+// TreasureValues returns the values of the treasure chips of the given type
+// in a standard game, in ascending order.
+func TreasureValues(tt TreasureType) []int {
 	var res []int
 	for _, v := range treasureValues[tt] {
 		res = append(res, v)
@@ -0,0 +1,307 @@
+// Package statetest contains a conformance test suite for implementations of
+// the state.State interface. Implementations are exercised against scripted
+// scenarios from the rules of deep sea adventure, and against the reference
+// standard state in differential random play.
+package statetest
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/bubblyworld/deep-sea-adventure/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Factory returns a fresh game state with the given number of players, laid
+// out as in the start of a standard game.
+type Factory func(players int) state.State
+
+// Number of random games to play in the randomised tests.
+const randomGames = 100
+
+// Run runs the full conformance suite against states built by the factory.
+func Run(t *testing.T, factory Factory) {
+	t.Run("Initial", func(t *testing.T) { testInitial(t, factory) })
+	t.Run("Hopping", func(t *testing.T) { testHopping(t, factory) })
+	t.Run("EndOfBoard", func(t *testing.T) { testEndOfBoard(t, factory) })
+	t.Run("PickUp", func(t *testing.T) { testPickUp(t, factory) })
+	t.Run("Drop", func(t *testing.T) { testDrop(t, factory) })
+	t.Run("Drowning", func(t *testing.T) { testDrowning(t, factory) })
+	t.Run("Surviving", func(t *testing.T) { testSurviving(t, factory) })
+	t.Run("EndOfGame", func(t *testing.T) { testEndOfGame(t, factory) })
+	t.Run("InvalidDecision", func(t *testing.T) { testInvalid(t, factory) })
+	t.Run("Undo", func(t *testing.T) { testUndo(t, factory) })
+	t.Run("Invariants", func(t *testing.T) { testInvariants(t, factory) })
+	t.Run("Differential", func(t *testing.T) { testDifferential(t, factory) })
+}
+
+func testInitial(t *testing.T, factory Factory) {
+	for n := 1; n <= 6; n++ {
+		s := factory(n)
+		assert.Equal(t, 1, s.Round())
+		assert.Equal(t, state.StageRoll, s.Stage())
+		assert.Equal(t, 25, s.Air())
+		assert.Equal(t, 0, s.CurrentPlayer())
+		require.Len(t, s.Players(), n)
+		for _, p := range s.Players() {
+			assert.Equal(t, 0, p.Position)
+			assert.False(t, p.TurnedAround)
+			assert.Empty(t, p.HeldTreasure)
+			assert.Empty(t, p.StashedTreasure)
+		}
+
+		// One submarine followed by 8 treasures of each type in order.
+		tl := s.Tiles()
+		require.Len(t, tl, 33)
+		assert.Equal(t, state.TileTypeSubmarine, tl[0].Type)
+		for i, tile := range tl[1:] {
+			require.Equal(t, state.TileTypeTreasure, tile.Type)
+			require.Len(t, *tile.Treasure, 1)
+			assert.EqualValues(t, 1+i/8, (*tile.Treasure)[0].Type)
+		}
+
+		assert.NoError(t, state.Check(s))
+	}
+}
+
+func testHopping(t *testing.T, factory Factory) {
+	s := factory(2)
+	do(t, s, state.Roll(2))
+	assert.Equal(t, 2, s.Players()[0].Position)
+	assert.Equal(t, state.StagePickUp, s.Stage())
+
+	do(t, s, state.PickUp(false))
+	assert.Equal(t, 1, s.CurrentPlayer())
+	assert.Equal(t, state.StageRoll, s.Stage())
+
+	// Player 1 hops over player 0 on their second step.
+	do(t, s, state.Roll(2))
+	assert.Equal(t, 3, s.Players()[1].Position)
+
+	// Player 0 is out of the submarine, so gets to decide whether to turn.
+	do(t, s, state.PickUp(false))
+	assert.Equal(t, 0, s.CurrentPlayer())
+	assert.Equal(t, state.StageTurn, s.Stage())
+	assert.ElementsMatch(t,
+		[]state.Decision{state.Turn(true), state.Turn(false)},
+		s.ValidDecisions())
+}
+
+func testEndOfBoard(t *testing.T, factory Factory) {
+	s := factory(1)
+	for i := 0; i < 5; i++ {
+		do(t, s, state.Roll(6), state.PickUp(false), state.Turn(false))
+	}
+	assert.Equal(t, 30, s.Players()[0].Position)
+
+	// There's no bounceback, so the player stops at the last tile and is
+	// then forced to turn around.
+	do(t, s, state.Roll(6), state.PickUp(false))
+	assert.Equal(t, 32, s.Players()[0].Position)
+	assert.Equal(t, state.StageTurn, s.Stage())
+	assert.Equal(t, []state.Decision{state.Turn(true)}, s.ValidDecisions())
+	assert.Error(t, s.Do(state.Turn(false)))
+}
+
+func testPickUp(t *testing.T, factory Factory) {
+	s := factory(2)
+	do(t, s, state.Roll(3))
+	assert.ElementsMatch(t,
+		[]state.Decision{state.PickUp(true), state.PickUp(false)},
+		s.ValidDecisions())
+
+	tile := *s.Tiles()[3].Treasure
+	do(t, s, state.PickUp(true))
+	assert.Equal(t, []state.TreasureStack{tile}, s.Players()[0].HeldTreasure)
+	assert.Equal(t, state.TileTypeEmpty, s.Tiles()[3].Type)
+	assert.Nil(t, s.Tiles()[3].Treasure)
+
+	// Held treasure costs air and slows the player down.
+	do(t, s, state.Roll(2), state.PickUp(false))
+	assert.Equal(t, 25, s.Air())
+	do(t, s, state.Turn(false), state.Roll(2))
+	assert.Equal(t, 24, s.Air())
+	assert.Equal(t, 4, s.Players()[0].Position)
+}
+
+func testDrop(t *testing.T, factory Factory) {
+	s := factory(1)
+	do(t, s, state.Roll(2), state.PickUp(true))
+	do(t, s, state.Turn(false), state.Roll(5), state.PickUp(true))
+	assert.Equal(t, 6, s.Players()[0].Position)
+	held := s.Players()[0].HeldTreasure
+	require.Len(t, held, 2)
+	first, second := held[0], held[1]
+
+	// Moving 6 - 2 = 4 tiles back lands on the tile emptied first.
+	do(t, s, state.Turn(true), state.Roll(6))
+	assert.Equal(t, 2, s.Players()[0].Position)
+	assert.Equal(t, state.StageDrop, s.Stage())
+	assert.ElementsMatch(t, []state.Decision{
+		state.Drop(0, false), state.Drop(0, true), state.Drop(1, true)},
+		s.ValidDecisions())
+
+	do(t, s, state.Drop(1, true))
+	assert.Equal(t, []state.TreasureStack{first}, s.Players()[0].HeldTreasure)
+	assert.Equal(t, state.TileTypeTreasure, s.Tiles()[2].Type)
+	assert.Equal(t, second, *s.Tiles()[2].Treasure)
+	assert.Equal(t, 22, s.Air())
+}
+
+func testDrowning(t *testing.T, factory Factory) {
+	s := factory(1)
+	do(t, s, state.Roll(2), state.PickUp(true))
+	for _, r := range []int{2, 3, 4, 5, 6} {
+		do(t, s, state.Turn(false), state.Roll(r), state.PickUp(true))
+	}
+	assert.Equal(t, 7, s.Players()[0].Position)
+	assert.Equal(t, 10, s.Air())
+
+	// The player can't move with six stacks, and so will never make it.
+	do(t, s, state.Turn(false), state.Roll(6), state.Drop(0, false))
+	assert.Equal(t, 4, s.Air())
+	do(t, s, state.Turn(true), state.Roll(6), state.Drop(0, false))
+
+	// The six sunk chips are placed at the end in stacks of three.
+	assert.Equal(t, 2, s.Round())
+	assert.Equal(t, state.StageRoll, s.Stage())
+	assert.Equal(t, 25, s.Air())
+	p := s.Players()[0]
+	assert.Equal(t, 0, p.Position)
+	assert.False(t, p.TurnedAround)
+	assert.Empty(t, p.HeldTreasure)
+	assert.Empty(t, p.StashedTreasure)
+
+	tl := s.Tiles()
+	require.Len(t, tl, 33-6+2)
+	for _, tile := range tl[len(tl)-2:] {
+		require.Equal(t, state.TileTypeTreasure, tile.Type)
+		assert.Len(t, *tile.Treasure, 3)
+	}
+	assert.NoError(t, state.Check(s))
+}
+
+func testSurviving(t *testing.T, factory Factory) {
+	s := factory(2)
+	do(t, s, state.Roll(2), state.PickUp(true))
+	tile := s.Players()[0].HeldTreasure[0]
+	do(t, s, state.Roll(4), state.PickUp(false))
+	do(t, s, state.Turn(true), state.Roll(3))
+	assert.True(t, s.Players()[0].Done())
+	assert.Equal(t, 1, s.CurrentPlayer())
+
+	// Player 1 is alone at sea, and returns on their next roll.
+	do(t, s, state.Turn(true), state.Roll(6))
+	assert.Equal(t, 2, s.Round())
+	assert.Equal(t, 25, s.Air())
+	assert.Equal(t, []state.TreasureStack{tile}, s.Players()[0].StashedTreasure)
+	assert.Empty(t, s.Players()[1].StashedTreasure)
+	assert.Len(t, s.Tiles(), 32) // the empty tile is removed
+	assert.NoError(t, state.Check(s))
+}
+
+func testEndOfGame(t *testing.T, factory Factory) {
+	s := factory(1)
+	for round := 1; round <= 3; round++ {
+		assert.Equal(t, round, s.Round())
+		do(t, s, state.Roll(2), state.PickUp(false))
+		do(t, s, state.Turn(true), state.Roll(2))
+	}
+
+	assert.Equal(t, state.StageEndOfGame, s.Stage())
+	assert.Empty(t, s.ValidDecisions())
+	assert.Error(t, s.Do(state.Roll(2)))
+	assert.NoError(t, state.Check(s))
+}
+
+func testInvalid(t *testing.T, factory Factory) {
+	s := factory(2)
+	key := state.Canonical(s, 0)
+	do(t, s, state.Roll(2))
+	after := state.Canonical(s, 0)
+
+	assert.Error(t, s.Do(state.Roll(3)))
+	assert.Equal(t, after, state.Canonical(s, 0))
+
+	// A rejected decision must not be recorded in the history.
+	require.NoError(t, s.Undo())
+	assert.Equal(t, key, state.Canonical(s, 0))
+	assert.Error(t, s.Undo())
+}
+
+func testUndo(t *testing.T, factory Factory) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < randomGames; i++ {
+		s := factory(1 + rng.Intn(6))
+		key := state.Canonical(s, 0)
+
+		var keys []state.Key
+		for len(s.ValidDecisions()) > 0 {
+			keys = append(keys, state.Canonical(s, 0))
+			vdl := s.ValidDecisions()
+			require.NoError(t, s.Do(vdl[rng.Intn(len(vdl))]))
+		}
+
+		for j := len(keys) - 1; j >= 0; j-- {
+			require.NoError(t, s.Undo())
+			require.Equal(t, keys[j], state.Canonical(s, 0))
+		}
+
+		assert.Equal(t, key, state.Canonical(s, 0))
+		assert.Error(t, s.Undo())
+	}
+}
+
+func testInvariants(t *testing.T, factory Factory) {
+	rng := rand.New(rand.NewSource(1))
+	newState := func() state.State { return factory(1 + rng.Intn(6)) }
+	assert.NoError(t, state.RandomPlayouts(newState, randomGames, rng))
+}
+
+// testDifferential plays random games against the reference implementation.
+// Treasure values are shuffled independently in each, so states are compared
+// by treasure type only. Values never affect how the game plays out.
+func testDifferential(t *testing.T, factory Factory) {
+	const eq = state.EquivalenceTreasureType
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < randomGames; i++ {
+		n := 1 + rng.Intn(6)
+		s, ref := factory(n), state.NewStandardState(n)
+
+		var dl []state.Decision
+		for {
+			require.Equal(t, state.Canonical(ref, eq), state.Canonical(s, eq),
+				"after %v", dl)
+			require.ElementsMatch(t, ref.ValidDecisions(), s.ValidDecisions(),
+				"after %v", dl)
+
+			vdl := ref.ValidDecisions()
+			if len(vdl) == 0 {
+				break
+			}
+
+			d := vdl[rng.Intn(len(vdl))]
+			dl = append(dl, d)
+			require.NoError(t, ref.Do(d))
+			require.NoError(t, s.Do(d), "after %v", dl)
+
+			// Occasionally step back to exercise undo as well.
+			if rng.Intn(10) == 0 {
+				require.NoError(t, ref.Undo())
+				require.NoError(t, s.Undo())
+				dl = dl[:len(dl)-1]
+			}
+		}
+	}
+}
+
+// do performs the given decisions in order, failing the test on error.
+func do(t *testing.T, s state.State, dl ...state.Decision) {
+	t.Helper()
+
+	for _, d := range dl {
+		require.NoError(t, s.Do(d), "doing %s", d)
+	}
+}